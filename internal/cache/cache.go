@@ -0,0 +1,297 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ironcore-dev/vgopath/internal/module"
+	"golang.org/x/mod/modfile"
+	xmodule "golang.org/x/mod/module"
+)
+
+// formatVersion is the version of the cache entry format. Entries of other versions are ignored.
+const formatVersion = 1
+
+// DefaultDir returns the vgopath directory inside the user cache directory.
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "vgopath"), nil
+}
+
+// Cache stores module lists on disk.
+type Cache struct {
+	dir      string
+	modCache string
+}
+
+// New returns a cache storing its entries in dir. modCache is the module cache of the go command, used
+// to detect modules that were downloaded after an entry was stored. Empty disables the check.
+func New(dir, modCache string) *Cache {
+	return &Cache{dir: dir, modCache: modCache}
+}
+
+type entry struct {
+	Version int
+	Modules []module.Module
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, "modules", key+".json")
+}
+
+// Get returns the modules stored for key. It reports false if there is no entry for key, if
+// the directory of any cached module does not exist anymore or if a cached module without
+// directory has been downloaded to the module cache since.
+func (c *Cache) Get(key string) ([]module.Module, bool, error) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil || e.Version != formatVersion {
+		return nil, false, nil
+	}
+
+	for _, mod := range e.Modules {
+		if !dirsExist(mod) || c.downloaded(mod) {
+			return nil, false, nil
+		}
+	}
+	return e.Modules, true, nil
+}
+
+// downloaded reports whether mod has no directory but is present in the module cache.
+func (c *Cache) downloaded(mod module.Module) bool {
+	if c.modCache == "" || mod.ResolvedDir() != "" {
+		return false
+	}
+
+	target := mod
+	if mod.Replace != nil {
+		target = *mod.Replace
+	}
+	if target.Version == "" {
+		return false
+	}
+
+	escPath, err := xmodule.EscapePath(target.Path)
+	if err != nil {
+		return false
+	}
+	escVersion, err := xmodule.EscapeVersion(target.Version)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(c.modCache, escPath+"@"+escVersion))
+	return err == nil
+}
+
+func dirsExist(mod module.Module) bool {
+	if mod.Dir != "" {
+		if stat, err := os.Stat(mod.Dir); err != nil || !stat.IsDir() {
+			return false
+		}
+	}
+	return mod.Replace == nil || dirsExist(*mod.Replace)
+}
+
+// Put stores mods for key, replacing any previous entry.
+func (c *Cache) Put(key string, mods []module.Module) error {
+	data, err := json.Marshal(entry{Version: formatVersion, Modules: mods})
+	if err != nil {
+		return err
+	}
+
+	filename := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so concurrent readers never see a partial entry.
+	f, err := os.CreateTemp(filepath.Dir(filename), key+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// Inputs are the inputs determining the module list reported by 'go list -m -json all'.
+type Inputs struct {
+	// Dir is the directory go list runs in.
+	Dir string
+	// WorkFile is the go.work file in use. Empty or module.GoWorkOff disables workspace mode.
+	WorkFile string
+	// ModFile is an alternate go.mod file.
+	ModFile string
+	// Values are further inputs, like GOFLAGS and the go version.
+	Values []string
+}
+
+// Key computes the cache key for the given inputs. It hashes the directory, the go.work and
+// go.work.sum files, the go.mod and go.sum files of all main modules, the go.mod files of their
+// local replacements and the values.
+func Key(in Inputs) (string, error) {
+	dir, err := filepath.Abs(in.Dir)
+	if err != nil {
+		return "", err
+	}
+
+	files, err := inputFiles(dir, in.WorkFile, in.ModFile)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	writeField(h, "dir", dir)
+	writeField(h, "workfile", in.WorkFile)
+	writeField(h, "modfile", in.ModFile)
+	for _, filename := range files {
+		if err := writeFile(h, filename); err != nil {
+			return "", err
+		}
+	}
+	for _, value := range in.Values {
+		writeField(h, "value", value)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeField(h hash.Hash, name, value string) {
+	_, _ = fmt.Fprintf(h, "%s %d\n%s\n", name, len(value), value)
+}
+
+func writeFile(h hash.Hash, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			writeField(h, "missing", filename)
+			return nil
+		}
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(h, "file %s %d\n", filename, stat.Size())
+	_, err = io.Copy(h, f)
+	return err
+}
+
+func inputFiles(dir, workFile, modFile string) ([]string, error) {
+	if workFile != "" && workFile != module.GoWorkOff {
+		return workspaceInputFiles(workFile)
+	}
+
+	if modFile == "" {
+		var err error
+		modFile, err = module.FindGoMod(dir)
+		if err != nil {
+			return nil, err
+		}
+	} else if !filepath.IsAbs(modFile) {
+		modFile = filepath.Join(dir, modFile)
+	}
+
+	file, err := parseGoMod(modFile)
+	if err != nil {
+		return nil, err
+	}
+	return append(goModInputFiles(modFile), replaceInputFiles(filepath.Dir(modFile), file.Replace)...), nil
+}
+
+func workspaceInputFiles(workFile string) ([]string, error) {
+	data, err := os.ReadFile(workFile)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := modfile.ParseWork(workFile, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", workFile, err)
+	}
+
+	workDir := filepath.Dir(workFile)
+	files := []string{workFile, workFile + ".sum"}
+	files = append(files, replaceInputFiles(workDir, file.Replace)...)
+	for _, use := range file.Use {
+		dir := use.Path
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(workDir, dir)
+		}
+
+		goModFile := filepath.Join(dir, module.GoModFileName)
+		modFile, err := parseGoMod(goModFile)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, goModInputFiles(goModFile)...)
+		files = append(files, replaceInputFiles(dir, modFile.Replace)...)
+	}
+	return files, nil
+}
+
+func parseGoMod(filename string) (*modfile.File, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := modfile.Parse(filename, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", filename, err)
+	}
+	return file, nil
+}
+
+// goModInputFiles returns the go.mod file and its go.sum file.
+func goModInputFiles(goModFile string) []string {
+	return []string{goModFile, strings.TrimSuffix(goModFile, ".mod") + ".sum"}
+}
+
+// replaceInputFiles returns the go.mod files of the local replacements relative to dir.
+func replaceInputFiles(dir string, replaces []*modfile.Replace) []string {
+	var files []string
+	for _, rep := range replaces {
+		if rep.New.Version != "" {
+			continue
+		}
+
+		path := rep.New.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		files = append(files, filepath.Join(path, module.GoModFileName))
+	}
+	return files
+}
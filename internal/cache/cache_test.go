@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cache_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/ironcore-dev/vgopath/internal/cache"
+	"github.com/ironcore-dev/vgopath/internal/module"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache", func() {
+	var (
+		c        *cache.Cache
+		modCache string
+		modDir   string
+	)
+	BeforeEach(func() {
+		modCache = GinkgoT().TempDir()
+		c = cache.New(GinkgoT().TempDir(), modCache)
+
+		modDir = filepath.Join(GinkgoT().TempDir(), "a")
+		Expect(os.Mkdir(modDir, 0777)).To(Succeed())
+	})
+
+	Describe("Get", func() {
+		It("should return the stored modules", func() {
+			mods := []module.Module{
+				{Path: "example.org/a", Version: "v1.0.0", Dir: modDir},
+				{Path: "example.org/b", Version: "v1.0.0"},
+			}
+			Expect(c.Put("key", mods)).To(Succeed())
+
+			res, ok, err := c.Get("key")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(res).To(Equal(mods))
+		})
+
+		It("should report a miss if there is no entry", func() {
+			_, ok, err := c.Get("key")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should report a miss if a module directory does not exist anymore", func() {
+			Expect(c.Put("key", []module.Module{{Path: "example.org/a", Version: "v1.0.0", Dir: modDir}})).To(Succeed())
+			Expect(os.Remove(modDir)).To(Succeed())
+
+			_, ok, err := c.Get("key")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should report a miss if a module has been downloaded since", func() {
+			Expect(c.Put("key", []module.Module{{Path: "example.org/Upper", Version: "v1.0.0"}})).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(modCache, "example.org", "!upper@v1.0.0"), 0777)).To(Succeed())
+
+			_, ok, err := c.Get("key")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("Key", func() {
+		var dir string
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.org/main\n\nreplace example.org/b => ./b\n"), 0666)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(dir, "b"), 0777)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "b", "go.mod"), []byte("module example.org/b\n"), 0666)).To(Succeed())
+		})
+
+		key := func(in cache.Inputs) string {
+			GinkgoHelper()
+			key, err := cache.Key(in)
+			Expect(err).NotTo(HaveOccurred())
+			return key
+		}
+
+		It("should be stable for the same inputs", func() {
+			Expect(key(cache.Inputs{Dir: dir})).To(Equal(key(cache.Inputs{Dir: dir})))
+		})
+
+		DescribeTable("should change if an input changes",
+			func(change func()) {
+				before := key(cache.Inputs{Dir: dir, Values: []string{"GOFLAGS="}})
+				change()
+				Expect(key(cache.Inputs{Dir: dir, Values: []string{"GOFLAGS="}})).NotTo(Equal(before))
+			},
+			Entry("go.mod", func() {
+				Expect(os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.org/main\n"), 0666)).To(Succeed())
+			}),
+			Entry("go.sum", func() {
+				Expect(os.WriteFile(filepath.Join(dir, "go.sum"), []byte("example.org/c v1.0.0 h1:abc=\n"), 0666)).To(Succeed())
+			}),
+			Entry("go.mod of a local replacement", func() {
+				Expect(os.WriteFile(filepath.Join(dir, "b", "go.mod"), []byte("module example.org/b\n\ngo 1.22\n"), 0666)).To(Succeed())
+			}),
+		)
+
+		It("should change if a value changes", func() {
+			Expect(key(cache.Inputs{Dir: dir, Values: []string{"GOFLAGS=-mod=mod"}})).
+				NotTo(Equal(key(cache.Inputs{Dir: dir, Values: []string{"GOFLAGS="}})))
+		})
+
+		It("should hash the go.mod files of a workspace", func() {
+			workFile := filepath.Join(dir, "go.work")
+			Expect(os.WriteFile(workFile, []byte("go 1.22\n\nuse ./b\n"), 0666)).To(Succeed())
+			before := key(cache.Inputs{Dir: dir, WorkFile: workFile})
+
+			Expect(os.WriteFile(filepath.Join(dir, "b", "go.sum"), []byte("example.org/c v1.0.0 h1:abc=\n"), 0666)).To(Succeed())
+			Expect(key(cache.Inputs{Dir: dir, WorkFile: workFile})).NotTo(Equal(before))
+		})
+
+		It("should error if there is no go.mod file", func() {
+			_, err := cache.Key(cache.Inputs{Dir: GinkgoT().TempDir()})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
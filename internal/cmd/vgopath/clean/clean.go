@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package clean
+
+import (
+	"github.com/ironcore-dev/vgopath/internal/link"
+	"github.com/spf13/cobra"
+)
+
+func Command() *cobra.Command {
+	var (
+		dstDir string
+		force  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Remove the entries vgopath created in a virtual GOPATH.",
+		Long: `Remove GOPATH/src, GOPATH/bin, GOPATH/pkg and the files vgopath keeps
+in the specified directory. Other entries are kept.
+
+vgopath refuses to clean a directory it has not marked as its own.
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return Run(dstDir, force)
+		},
+	}
+
+	cmd.Flags().StringVarP(&dstDir, "dst-dir", "o", "", "Destination directory.")
+	_ = cmd.MarkFlagRequired("dst-dir")
+	cmd.Flags().BoolVar(&force, "force", false, "Whether to clean a directory that was not created by vgopath.")
+
+	return cmd
+}
+
+func Run(dstDir string, force bool) error {
+	return link.Clean(dstDir, force)
+}
@@ -10,14 +10,16 @@ import (
 	"regexp"
 
 	"github.com/ironcore-dev/vgopath/internal/link"
+	"github.com/ironcore-dev/vgopath/internal/module"
 	"github.com/spf13/cobra"
 )
 
 func Command() *cobra.Command {
 	var (
-		opts   link.Options
-		dstDir string
-		shell  bool
+		opts       link.Options
+		dstDir     string
+		shell      bool
+		sharedLock bool
 	)
 
 	cmd := &cobra.Command{
@@ -31,13 +33,14 @@ func Command() *cobra.Command {
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			executable, executableArgs := executableAndArgs(args, shell)
-			return Run(dstDir, executable, opts, executableArgs)
+			return Run(dstDir, executable, opts, executableArgs, sharedLock)
 		},
 	}
 
 	opts.AddFlags(cmd.Flags())
 	cmd.Flags().StringVarP(&dstDir, "dst-dir", "o", "", "Destination directory. If empty, a temporary directory will be created.")
 	cmd.Flags().BoolVarP(&shell, "shell", "s", false, "Whether to run the command in a shell.")
+	cmd.Flags().BoolVar(&sharedLock, "shared-lock", false, "Whether to hold a shared lock on the destination directory while the command runs, so concurrent relinks wait for it.")
 
 	return cmd
 }
@@ -55,7 +58,12 @@ func executableAndArgs(args []string, doShell bool) (string, []string) {
 	return shell, []string{"-c", args[0]}
 }
 
-func Run(dstDir, executable string, opts link.Options, args []string) error {
+func Run(dstDir, executable string, opts link.Options, args []string, sharedLock bool) error {
+	// The executable inherits stdin, so it cannot also be the source of the modules.
+	if opts.ModulesFrom == module.Stdin {
+		return fmt.Errorf("cannot read modules from stdin when running an executable, use a file instead")
+	}
+
 	if dstDir == "" {
 		var err error
 		dstDir, err = os.MkdirTemp("", "vgopath")
@@ -65,7 +73,13 @@ func Run(dstDir, executable string, opts link.Options, args []string) error {
 		defer func() { _ = os.RemoveAll(dstDir) }()
 	}
 
-	if err := link.Link(dstDir, opts); err != nil {
+	if sharedLock {
+		l, err := link.LinkShared(dstDir, opts)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = l.Unlock() }()
+	} else if err := link.Link(dstDir, opts); err != nil {
 		return err
 	}
 
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ironcore-dev/vgopath/internal/link"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ErrMismatch is returned if the virtual GOPATH does not match the project.
+var ErrMismatch = errors.New("virtual GOPATH does not match the project")
+
+func Command() *cobra.Command {
+	var (
+		opts   link.Options
+		dstDir string
+		format string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify a virtual GOPATH matches the project.",
+		Long: `Verify compares the virtual GOPATH at the specified directory with the
+tree vgopath would create now, without changing it. It reports added, removed
+and changed modules, dangling symlinks, foreign and outdated entries and exits
+non-zero if there are any.
+`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return Run(cmd.OutOrStdout(), dstDir, opts, format)
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&dstDir, "dst-dir", "o", "", "Destination directory.")
+	_ = cmd.MarkFlagRequired("dst-dir")
+	cmd.Flags().StringVar(&format, "format", FormatText, "Format of the report. One of text, json.")
+
+	return cmd
+}
+
+// Run writes the report of verifying dstDir to w. It returns ErrMismatch if dstDir does not match.
+func Run(w io.Writer, dstDir string, opts link.Options, format string) error {
+	if format != FormatText && format != FormatJSON {
+		return fmt.Errorf("invalid format %q, must be one of %s, %s", format, FormatText, FormatJSON)
+	}
+
+	report, err := link.Verify(dstDir, opts)
+	if err != nil {
+		return err
+	}
+
+	if format == FormatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = writeText(w, report)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !report.OK() {
+		return ErrMismatch
+	}
+	return nil
+}
+
+func writeText(w io.Writer, report *link.VerifyReport) error {
+	var lines []string
+	if report.NoManifest {
+		lines = append(lines, "no manifest, run vgopath to create one")
+	}
+	for _, mod := range report.AddedModules {
+		lines = append(lines, fmt.Sprintf("added module %s", moduleString(mod.Path, mod.Version)))
+	}
+	for _, mod := range report.RemovedModules {
+		lines = append(lines, fmt.Sprintf("removed module %s", moduleString(mod.Path, mod.Version)))
+	}
+	for _, change := range report.ChangedModules {
+		lines = append(lines, fmt.Sprintf("changed module %s: %s (%s) -> %s (%s)",
+			change.Path, change.OldVersion, change.OldDir, change.NewVersion, change.NewDir))
+	}
+	for _, path := range report.Dangling {
+		lines = append(lines, "dangling symlink "+path)
+	}
+	for _, path := range report.Foreign {
+		lines = append(lines, "foreign entry "+path)
+	}
+	for _, path := range report.Outdated {
+		lines = append(lines, "outdated entry "+path)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "ok")
+	}
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func moduleString(path, version string) string {
+	if version == "" {
+		return path
+	}
+	return path + "@" + version
+}
@@ -4,10 +4,15 @@
 package vgopath
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 
 	"github.com/ironcore-dev/vgopath/internal/cmd/version"
+	"github.com/ironcore-dev/vgopath/internal/cmd/vgopath/clean"
 	"github.com/ironcore-dev/vgopath/internal/cmd/vgopath/exec"
+	"github.com/ironcore-dev/vgopath/internal/cmd/vgopath/verify"
 	"github.com/ironcore-dev/vgopath/internal/link"
 	"github.com/spf13/cobra"
 )
@@ -16,6 +21,7 @@ func Command() *cobra.Command {
 	var (
 		opts   link.Options
 		dstDir string
+		dryRun string
 	)
 
 	cmd := &cobra.Command{
@@ -31,6 +37,9 @@ after 'module') points at.
 `,
 		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if dryRun != "" {
+				return DryRun(cmd.OutOrStdout(), dstDir, opts, dryRun)
+			}
 			return Run(dstDir, opts)
 		},
 	}
@@ -38,9 +47,13 @@ after 'module') points at.
 	opts.AddFlags(cmd.Flags())
 	cmd.Flags().StringVarP(&dstDir, "dst-dir", "o", "", "Destination directory.")
 	_ = cmd.MarkFlagRequired("dst-dir")
+	cmd.Flags().StringVar(&dryRun, "dry-run", "", "Print the changes instead of making them. One of text, json. Specifying the flag without value prints text.")
+	cmd.Flags().Lookup("dry-run").NoOptDefVal = DryRunText
 
 	cmd.AddCommand(
+		clean.Command(),
 		exec.Command(),
+		verify.Command(),
 		version.Command(os.Stdout),
 	)
 
@@ -50,3 +63,32 @@ after 'module') points at.
 func Run(dstDir string, opts link.Options) error {
 	return link.Link(dstDir, opts)
 }
+
+const (
+	DryRunText = "text"
+	DryRunJSON = "json"
+)
+
+func DryRun(w io.Writer, dstDir string, opts link.Options, format string) error {
+	if format != DryRunText && format != DryRunJSON {
+		return fmt.Errorf("invalid dry run format %q, must be one of %s, %s", format, DryRunText, DryRunJSON)
+	}
+
+	plan, err := link.PlanLink(dstDir, opts)
+	if err != nil {
+		return err
+	}
+
+	if format == DryRunJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+
+	for _, op := range plan.Ops {
+		if _, err := fmt.Fprintln(w, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// stagingSuffix is appended to a directory to get its staging directory.
+const stagingSuffix = ".vgopath-staging"
+
+// swapDir replaces the entry at path with the directory staging. If the platform supports it,
+// both are exchanged atomically, otherwise the old entry is moved aside for the time of the swap
+// and moved back if the swap fails.
+func swapDir(staging, path string) error {
+	if _, err := os.Lstat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return os.Rename(staging, path)
+		}
+		return err
+	}
+
+	if err := exchange(staging, path); err == nil {
+		// The staging directory now holds the old entry.
+		return os.RemoveAll(staging)
+	}
+
+	old := path + ".vgopath-old"
+	if err := os.RemoveAll(old); err != nil {
+		return err
+	}
+	if err := os.Rename(path, old); err != nil {
+		return err
+	}
+	if err := os.Rename(staging, path); err != nil {
+		_ = os.Rename(old, path)
+		return err
+	}
+	return os.RemoveAll(old)
+}
@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	. "github.com/ironcore-dev/vgopath/internal/link"
+	"github.com/ironcore-dev/vgopath/internal/module"
+)
+
+// syntheticModules returns n modules in random order, spread across a few hosts and many
+// organizations, with every fourth repository having nested modules.
+func syntheticModules(n int) []module.Module {
+	hosts := []string{"github.com", "gitlab.com", "k8s.io", "sigs.k8s.io", "golang.org/x"}
+	mods := make([]module.Module, 0, n)
+	for i := 0; len(mods) < n; i++ {
+		repo := fmt.Sprintf("%s/org%d/repo%d", hosts[i%len(hosts)], i%500, i)
+		mods = append(mods, module.Module{Path: repo, Dir: "/go/pkg/mod/" + repo})
+		if i%4 == 0 {
+			for _, sub := range []string{"api", "api/v2", "tools"} {
+				mods = append(mods, module.Module{Path: repo + "/" + sub, Dir: "/go/pkg/mod/" + repo + "/" + sub})
+			}
+		}
+	}
+	mods = mods[:n]
+
+	rnd := rand.New(rand.NewPCG(1, 2))
+	rnd.Shuffle(len(mods), func(i, j int) { mods[i], mods[j] = mods[j], mods[i] })
+	return mods
+}
+
+func BenchmarkBuildModuleNodes(b *testing.B) {
+	for _, n := range []int{10_000, 50_000, 100_000} {
+		b.Run(fmt.Sprintf("modules=%d", n), func(b *testing.B) {
+			mods := syntheticModules(n)
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := BuildModuleNodes(mods); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
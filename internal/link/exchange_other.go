@@ -0,0 +1,13 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package link
+
+import "errors"
+
+// exchange is not supported outside of Linux, callers fall back to renaming one after the other.
+func exchange(_, _ string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link
+
+import (
+	"runtime"
+	"sync"
+)
+
+// jobs bounds the number of goroutines working concurrently. The calling goroutine always
+// works as well, so a nil jobs works sequentially.
+type jobs chan struct{}
+
+// newJobs returns jobs for n concurrent workers. n < 1 uses GOMAXPROCS workers.
+func newJobs(n int) jobs {
+	if n < 1 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	return make(jobs, n-1)
+}
+
+// run calls f for every index in [0, n), concurrently while there are free workers. It returns
+// the error of the lowest failing index, independent of the order the calls finish in.
+func (j jobs) run(n int, f func(i int) error) error {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, n)
+	)
+	for i := range n {
+		select {
+		case j <- struct{}{}:
+			wg.Go(func() {
+				defer func() { <-j }()
+				errs[i] = f(i)
+			})
+			continue
+		default:
+		}
+
+		// No worker is free, so do the work ourselves. After an error, the remaining
+		// indices cannot change the result anymore.
+		if errs[i] = f(i); errs[i] != nil {
+			break
+		}
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
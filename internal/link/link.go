@@ -4,16 +4,18 @@
 package link
 
 import (
+	"errors"
 	"fmt"
 	"go/build"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
-	"sort"
 	"strings"
 
 	"github.com/spf13/pflag"
 
+	"github.com/ironcore-dev/vgopath/internal/cache"
 	"github.com/ironcore-dev/vgopath/internal/module"
 )
 
@@ -23,71 +25,105 @@ type Node struct {
 	Children []Node
 }
 
-func insertModuleInNode(node *Node, mod module.Module, relativeSegments []string) error {
-	if len(relativeSegments) == 0 {
-		if node.Module != nil {
-			return fmt.Errorf("cannot insert module %s into node %s: module %s already exists", mod.Path, node.Segment, node.Module.Path)
+// BuildModuleNodes builds the tree of the module paths. The nodes and their children are sorted
+// by segment. The modules are not modified.
+func BuildModuleNodes(modules []module.Module) ([]Node, error) {
+	root := &trieNode{}
+	for i := range modules {
+		mod := modules[i]
+		if mod.Path == "" {
+			return nil, fmt.Errorf("invalid empty module path")
 		}
 
-		node.Module = &mod
-		return nil
+		if err := root.insert(&mod); err != nil {
+			return nil, err
+		}
 	}
+	return root.nodes(), nil
+}
 
+// DeduplicateModules collapses modules sharing the same path.
+// In a workspace, a main module shadows a dependency with the same path. Two modules
+// with the same path but different directories cannot be linked and result in an error.
+func DeduplicateModules(modules []module.Module) ([]module.Module, error) {
 	var (
-		idx     = -1
-		segment = relativeSegments[0]
+		res       []module.Module
+		idxByPath = make(map[string]int)
 	)
-	for i, child := range node.Children {
-		if child.Segment == segment {
-			idx = i
-			break
+	for _, mod := range modules {
+		idx, ok := idxByPath[mod.Path]
+		if !ok {
+			idxByPath[mod.Path] = len(res)
+			res = append(res, mod)
+			continue
 		}
-	}
 
-	var child *Node
-	if idx == -1 {
-		child = &Node{Segment: segment}
-	} else {
-		child = &node.Children[idx]
+		existing := res[idx]
+		switch {
+		case existing.Main && !mod.Main:
+		case mod.Main && !existing.Main:
+			res[idx] = mod
+		case existing.Dir == mod.Dir:
+		default:
+			return nil, fmt.Errorf("module %s is provided by both %s and %s", mod.Path, existing.Dir, mod.Dir)
+		}
 	}
+	return res, nil
+}
 
-	if err := insertModuleInNode(child, mod, relativeSegments[1:]); err != nil {
-		return err
+// ResolveModuleDirs fills in the directory of replaced modules from their replacement.
+func ResolveModuleDirs(modules []module.Module) []module.Module {
+	res := make([]module.Module, 0, len(modules))
+	for _, mod := range modules {
+		mod.Dir = mod.ResolvedDir()
+		res = append(res, mod)
 	}
+	return res
+}
 
-	if idx == -1 {
-		node.Children = append(node.Children, *child)
+// ModuleErrors returns an error listing every module that go list failed to load, or nil if there is none.
+func ModuleErrors(modules []module.Module) error {
+	var errs []error
+	for _, mod := range modules {
+		if mod.Error != nil {
+			errs = append(errs, fmt.Errorf("module %s: %w", mod.String(), mod.Error))
+		}
+		if mod.Replace != nil && mod.Replace.Error != nil {
+			errs = append(errs, fmt.Errorf("module %s (replaced by %s): %w", mod.String(), mod.Replace.String(), mod.Replace.Error))
+		}
 	}
-
-	return nil
+	return errors.Join(errs...)
 }
 
-func BuildModuleNodes(modules []module.Module) ([]Node, error) {
-	sort.Slice(modules, func(i, j int) bool { return modules[i].Path < modules[j].Path })
-	nodeByRootSegment := make(map[string]*Node)
-
+// DownloadModulesWithoutDir downloads all non-main modules without a directory and returns
+// the modules with the directories of the downloaded modules filled in.
+func DownloadModulesWithoutDir(modules []module.Module, opts ...module.DownloadOption) ([]module.Module, error) {
+	var missing []module.Module
 	for _, mod := range modules {
-		if mod.Path == "" {
-			return nil, fmt.Errorf("invalid empty module path")
+		if !mod.Main && mod.Dir == "" {
+			missing = append(missing, mod)
 		}
+	}
+	if len(missing) == 0 {
+		return modules, nil
+	}
 
-		segments := strings.Split(mod.Path, "/")
-
-		rootSegment := segments[0]
-		node, ok := nodeByRootSegment[rootSegment]
-		if !ok {
-			node = &Node{Segment: rootSegment}
-			nodeByRootSegment[rootSegment] = node
-		}
+	downloaded, err := module.Download(missing, opts...)
+	if err != nil {
+		return nil, err
+	}
 
-		if err := insertModuleInNode(node, mod, segments[1:]); err != nil {
-			return nil, err
-		}
+	dirByPath := make(map[string]string, len(downloaded))
+	for _, mod := range downloaded {
+		dirByPath[mod.Path] = mod.Dir
 	}
 
-	res := make([]Node, 0, len(nodeByRootSegment))
-	for _, node := range nodeByRootSegment {
-		res = append(res, *node)
+	res := make([]module.Module, 0, len(modules))
+	for _, mod := range modules {
+		if dir, ok := dirByPath[mod.Path]; ok && !mod.Main && mod.Dir == "" {
+			mod.Dir = dir
+		}
+		res = append(res, mod)
 	}
 	return res, nil
 }
@@ -106,179 +142,516 @@ func FilterModulesWithoutDir(modules []module.Module) []module.Module {
 	return res
 }
 
+const (
+	VendorAuto = "auto"
+	VendorOn   = "on"
+	VendorOff  = "off"
+)
+
 type Options struct {
-	SrcDir    string
+	SrcDir      string
+	ModulesFrom string
+	WorkFile    string
+	Offline     bool
+	Vendor      string
+	Download    bool
+	NoCache     bool
+	Jobs        int
+	Force       bool
+	Merge       bool
+	Conflict    string
+	Atomic      bool
+
+	RelativeLinks bool
+	MapPrefixes   []string
+
+	Mode        string
+	MainMode    string
+	ModuleModes []string
+
+	GoBinary    string
+	GoToolchain string
+	GoFlags     []string
+	ModFile     string
+	GOOS        string
+	GOARCH      string
+	Env         []string
+
 	SkipGoBin bool
 	SkipGoSrc bool
 	SkipGoPkg bool
+
+	// Stderr receives the diagnostics of a failing go list call. Nil uses os.Stderr.
+	Stderr io.Writer
 }
 
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.SrcDir, "src-dir", o.SrcDir, "Source directory for linking. Empty string indicates current directory.")
+	fs.StringVar(&o.ModulesFrom, "modules-from", o.ModulesFrom, "File in the 'go list -m -json' format to read the modules from instead of resolving them. '-' reads from stdin.")
+	fs.StringVar(&o.WorkFile, "workfile", o.WorkFile, "go.work file to use. 'off' disables workspace mode. Empty string detects the workspace like the go command.")
+	fs.BoolVar(&o.Offline, "offline", o.Offline, "Resolve modules from go.mod files and the module cache without invoking the go command.")
+	fs.StringVar(&o.Vendor, "vendor", o.Vendor, "Whether to link the modules from vendor/modules.txt. One of auto, on, off. Empty string or auto follows the -mod go flag, or uses the vendor directory if vendor/modules.txt exists outside of a workspace and the go version is 1.14 or higher.")
+	fs.BoolVar(&o.Download, "download", o.Download, "Whether to download modules that are missing from the module cache instead of skipping them.")
+	fs.BoolVar(&o.NoCache, "no-cache", o.NoCache, "Whether to always run go list instead of using the cached module list.")
+	fs.IntVar(&o.Jobs, "jobs", o.Jobs, "Number of subtrees to link concurrently. 0 uses the number of CPUs.")
+	fs.BoolVar(&o.Force, "force", o.Force, "Whether to link into a non-empty destination directory that was not created by vgopath.")
+	fs.BoolVar(&o.Merge, "merge", o.Merge, "Whether to merge into an existing GOPATH, keeping the entries not created by vgopath.")
+	fs.StringVar(&o.Conflict, "conflict", o.Conflict, "Policy for entries colliding with entries not created by vgopath in merge mode. One of fail, skip, override. Empty string fails.")
+	fs.BoolVar(&o.Atomic, "atomic", o.Atomic, "Whether to build GOPATH/src in a staging directory and swap it in once complete, keeping the old tree on failure.")
+	fs.BoolVar(&o.RelativeLinks, "relative-links", o.RelativeLinks, "Whether to make symlink targets relative to the location of the symlink.")
+	fs.StringArrayVar(&o.MapPrefixes, "map-prefix", o.MapPrefixes, "<host prefix>=<target prefix> rule rewriting symlink targets below the host prefix to the target prefix, e.g. when using the tree in a container. Can be specified multiple times.")
+	fs.StringVar(&o.Mode, "mode", o.Mode, "How to materialize the module entries in GOPATH/src. One of symlink, hardlink, copy, reflink. Empty string symlinks.")
+	fs.StringVar(&o.MainMode, "main-mode", o.MainMode, "Mode for the main modules. Empty string uses --mode.")
+	fs.StringArrayVar(&o.ModuleModes, "module-mode", o.ModuleModes, "<pattern>=<mode> rule selecting the mode for modules whose path matches the pattern. The first matching rule wins. Can be specified multiple times.")
+	fs.StringVar(&o.GoBinary, "go", o.GoBinary, "Path of the go binary to invoke. Empty string uses go from $PATH.")
+	fs.StringVar(&o.GoToolchain, "gotoolchain", o.GoToolchain, "GOTOOLCHAIN to invoke the go command with.")
+	fs.StringArrayVar(&o.GoFlags, "goflags", o.GoFlags, "Additional GOFLAGS entry to invoke the go command with. Can be specified multiple times.")
+	fs.StringVar(&o.ModFile, "modfile", o.ModFile, "Alternate go.mod file to read modules from, e.g. hack/tools/go.mod.")
+	fs.StringVar(&o.GOOS, "goos", o.GOOS, "GOOS to invoke the go command with.")
+	fs.StringVar(&o.GOARCH, "goarch", o.GOARCH, "GOARCH to invoke the go command with.")
+	fs.StringArrayVar(&o.Env, "env", o.Env, "Additional KEY=VALUE environment variable to invoke the go command with. Can be specified multiple times.")
 	fs.BoolVar(&o.SkipGoPkg, "skip-go-pkg", o.SkipGoPkg, "Whether to skip mirroring $GOPATH/pkg")
 	fs.BoolVar(&o.SkipGoBin, "skip-go-bin", o.SkipGoBin, "Whether to skip mirroring $GOBIN")
 	fs.BoolVar(&o.SkipGoSrc, "skip-go-src", o.SkipGoSrc, "Whether to skip mirroring modules as src")
 }
 
+// Link links the GOPATH for the modules of opts.SrcDir into dstDir. It holds the exclusive lock
+// on dstDir while linking.
 func Link(dstDir string, opts Options) error {
+	return lockedOwned(dstDir, opts, func() error {
+		return link(dstDir, opts)
+	})
+}
+
+// LinkShared is like Link but returns holding a shared lock on dstDir, so it can be used without
+// being relinked concurrently until the lock is released.
+//
+// The exclusive lock is converted into the shared one, which flock does not do atomically: a
+// concurrent Link waiting for the exclusive lock may relink dstDir in between. dstDir then holds
+// the complete tree of that run, which may differ from the one linked for opts.
+func LinkShared(dstDir string, opts Options) (*Lock, error) {
+	l, err := lockOwned(dstDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := link(dstDir, opts); err != nil {
+		_ = l.Unlock()
+		return nil, err
+	}
+	if err := l.Shared(); err != nil {
+		_ = l.Unlock()
+		return nil, err
+	}
+	return l, nil
+}
+
+func link(dstDir string, opts Options) error {
+	plan, err := PlanLink(dstDir, opts)
+	if err != nil {
+		return err
+	}
+	return apply(plan, newJobs(opts.Jobs))
+}
+
+// PlanLink computes the changes Link would make to dstDir without making them.
+func PlanLink(dstDir string, opts Options) (*Plan, error) {
 	if opts.SrcDir == "" {
 		opts.SrcDir = "."
 	}
 
+	r, err := newReconciler(dstDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.own(opts); err != nil {
+		return nil, err
+	}
+
+	var manifest *Manifest
 	if !opts.SkipGoSrc {
-		if err := GoSrc(dstDir, opts.SrcDir); err != nil {
-			return fmt.Errorf("error linking GOPATH/src: %w", err)
+		if manifest, err = planGoSrc(r, opts); err != nil {
+			return nil, fmt.Errorf("error linking GOPATH/src: %w", err)
 		}
+	} else if manifest, err = skippedSrcManifest(dstDir, opts); err != nil {
+		return nil, err
 	}
 
 	if !opts.SkipGoBin {
-		if err := GoBin(dstDir); err != nil {
-			return fmt.Errorf("error linking GOPATH/bin: %w", err)
+		if err := planGoBin(r); err != nil && !errors.Is(err, errSkip) {
+			return nil, fmt.Errorf("error linking GOPATH/bin: %w", err)
 		}
 	}
 
 	if !opts.SkipGoPkg {
-		if err := GoPkg(dstDir); err != nil {
-			return fmt.Errorf("error linking GOPATH/pkg: %w", err)
+		if err := planGoPkg(r); err != nil && !errors.Is(err, errSkip) {
+			return nil, fmt.Errorf("error linking GOPATH/pkg: %w", err)
 		}
 	}
 
-	return nil
+	plan := r.plan()
+	if !opts.SkipGoSrc {
+		manifest.Modules = r.modules
+	}
+	manifest.Links = r.links
+	plan.Manifest = manifest
+	return plan, nil
 }
 
 func GoBin(dstDir string) error {
-	dstGoBinDir := filepath.Join(dstDir, "bin")
-	if err := os.RemoveAll(dstGoBinDir); err != nil {
-		return err
-	}
+	return lockedOwned(dstDir, Options{}, func() error {
+		r := &reconciler{root: dstDir}
+		if err := r.own(Options{}); err != nil {
+			return err
+		}
+		if err := planGoBin(r); err != nil {
+			return err
+		}
+		return apply(r.plan(), r.jobs)
+	})
+}
 
+func planGoBin(r *reconciler) error {
 	srcGoBinDir := os.Getenv("GOBIN")
 	if srcGoBinDir == "" {
 		srcGoBinDir = filepath.Join(build.Default.GOPATH, "bin")
 	}
+	return r.ownedLink("bin", srcGoBinDir)
+}
 
-	if err := os.Symlink(srcGoBinDir, dstGoBinDir); err != nil {
-		return err
+func GoPkg(dstDir string) error {
+	return lockedOwned(dstDir, Options{}, func() error {
+		r := &reconciler{root: dstDir}
+		if err := r.own(Options{}); err != nil {
+			return err
+		}
+		if err := planGoPkg(r); err != nil {
+			return err
+		}
+		return apply(r.plan(), r.jobs)
+	})
+}
+
+func planGoPkg(r *reconciler) error {
+	return r.ownedLink("pkg", filepath.Join(build.Default.GOPATH, "pkg"))
+}
+
+func workFile(opts Options) (string, error) {
+	switch opts.WorkFile {
+	case "":
+		return module.FindGoWork(opts.SrcDir)
+	case module.GoWorkOff:
+		return module.GoWorkOff, nil
+	default:
+		return filepath.Abs(opts.WorkFile)
 	}
-	return nil
 }
 
-func GoPkg(dstDir string) error {
-	dstGoPkgDir := filepath.Join(dstDir, "pkg")
-	if err := os.RemoveAll(dstGoPkgDir); err != nil {
-		return err
+func useVendor(opts Options, workFile string, goCmd *module.GoCommandOptions) (bool, error) {
+	switch opts.Vendor {
+	case VendorOn:
+		return true, nil
+	case VendorOff:
+		return false, nil
+	case "", VendorAuto:
+		// Like the go command, the vendor directory of a module is not used in workspace mode.
+		if workFile != "" && workFile != module.GoWorkOff {
+			return false, nil
+		}
+		switch goCmd.ModFlag() {
+		case "vendor":
+			return true, nil
+		case "mod", "readonly":
+			return false, nil
+		}
+		return module.IsVendored(opts.SrcDir)
+	default:
+		return false, fmt.Errorf("invalid vendor mode %q, must be one of %s, %s, %s", opts.Vendor, VendorAuto, VendorOn, VendorOff)
 	}
+}
 
-	if err := os.Symlink(filepath.Join(build.Default.GOPATH, "pkg"), dstGoPkgDir); err != nil {
-		return err
+func goCommandOptions(opts Options) (*module.GoCommandOptions, error) {
+	for _, kv := range opts.Env {
+		if k, _, ok := strings.Cut(kv, "="); !ok || k == "" {
+			return nil, fmt.Errorf("invalid environment variable %q, must be KEY=VALUE", kv)
+		}
 	}
-	return nil
+
+	modFile := opts.ModFile
+	if modFile != "" {
+		var err error
+		modFile, err = filepath.Abs(modFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &module.GoCommandOptions{
+		GoBinary:    opts.GoBinary,
+		GoToolchain: opts.GoToolchain,
+		GoFlags:     opts.GoFlags,
+		ModFile:     modFile,
+		GOOS:        opts.GOOS,
+		GOARCH:      opts.GOARCH,
+		Env:         opts.Env,
+	}, nil
 }
 
-func GoSrc(dstDir, srcDir string) error {
-	mods, err := module.ReadAllGoListModules(module.InDir(srcDir))
+func readModules(opts Options, workFile string, goCmd *module.GoCommandOptions) ([]module.Module, error) {
+	if opts.ModulesFrom != "" {
+		if opts.Offline || opts.ModFile != "" || opts.Vendor == VendorOn {
+			return nil, fmt.Errorf("cannot read modules from a file together with offline, modfile or vendor mode")
+		}
+		return module.ReadAllFileModules(opts.ModulesFrom)
+	}
+
+	if opts.ModFile != "" {
+		// An alternate go.mod file is only understood by the go command.
+		if opts.Offline {
+			return nil, fmt.Errorf("cannot use an alternate go.mod file in offline mode")
+		}
+		if opts.Vendor == VendorOn {
+			return nil, fmt.Errorf("cannot use an alternate go.mod file with vendor mode %s", VendorOn)
+		}
+		return readGoListModules(opts, workFile, goCmd)
+	}
+
+	useVendor, err := useVendor(opts, workFile, goCmd)
 	if err != nil {
-		return fmt.Errorf("error reading modules: %w", err)
+		return nil, err
+	}
+	if useVendor {
+		return module.ReadAllVendorModules(module.InDir(opts.SrcDir))
 	}
 
-	mods = FilterModulesWithoutDir(mods)
+	if opts.Offline {
+		return module.ReadAllOfflineModules(module.InDir(opts.SrcDir), module.WithWorkFile(workFile))
+	}
+	return readGoListModules(opts, workFile, goCmd)
+}
 
-	nodes, err := BuildModuleNodes(mods)
+// readGoListModules runs go list, using the module cache unless disabled. The cache is best-effort:
+// If the cache key cannot be computed or the cache cannot be accessed, go list is run.
+func readGoListModules(opts Options, workFile string, goCmd *module.GoCommandOptions) ([]module.Module, error) {
+	readAll := func() ([]module.Module, error) {
+		return module.ReadAllGoListModules(module.InDir(opts.SrcDir), module.WithWorkFile(workFile), goCmd)
+	}
+	if opts.NoCache {
+		return readAll()
+	}
+
+	c, key, err := goListCache(opts, workFile, goCmd)
 	if err != nil {
-		return fmt.Errorf("error building module tree: %w", err)
+		return readAll()
 	}
 
-	dstGoSrcDir := filepath.Join(dstDir, "src")
-	if err := os.RemoveAll(dstGoSrcDir); err != nil {
-		return err
+	if mods, ok, err := c.Get(key); err == nil && ok {
+		return mods, nil
 	}
 
-	if err := os.Mkdir(dstGoSrcDir, 0777); err != nil {
-		return err
+	mods, err := readAll()
+	if err != nil {
+		return nil, err
+	}
+	if ModuleErrors(mods) == nil {
+		_ = c.Put(key, mods)
 	}
+	return mods, nil
+}
 
-	if err := Nodes(dstGoSrcDir, nodes); err != nil {
-		return err
+func goListCache(opts Options, workFile string, goCmd *module.GoCommandOptions) (*cache.Cache, string, error) {
+	cacheDir, err := cache.DefaultDir()
+	if err != nil {
+		return nil, "", err
 	}
-	return nil
+
+	goVersion, err := module.GoVersion(opts.SrcDir, goCmd)
+	if err != nil {
+		return nil, "", err
+	}
+
+	modCache := module.DefaultModCache()
+	key, err := cache.Key(cache.Inputs{
+		Dir:      opts.SrcDir,
+		WorkFile: workFile,
+		ModFile:  goCmd.ModFile,
+		Values: append([]string{
+			"GOVERSION=" + goVersion,
+			"GOMODCACHE=" + modCache,
+		}, goCommandValues(goCmd)...),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return cache.New(cacheDir, modCache), key, nil
 }
 
-type linkNodeError struct {
-	path string
-	err  error
+// printedGoListError is a *module.GoListError whose diagnostics were printed to the user.
+type printedGoListError struct {
+	*module.GoListError
 }
 
-func (l *linkNodeError) Error() string {
-	return fmt.Sprintf("[path %s]: %v", l.path, l.err)
+func (e printedGoListError) Error() string {
+	return fmt.Sprintf("go list failed with exit code %d, see the errors above", e.ExitCode)
 }
 
-func joinLinkNodeError(node Node, err error) error {
-	if linkNodeErr, ok := err.(*linkNodeError); ok {
-		return &linkNodeError{
-			path: path.Join(node.Segment, linkNodeErr.path),
-			err:  linkNodeErr.err,
+func (e printedGoListError) Unwrap() error {
+	return e.GoListError
+}
+
+// printGoListError prints the diagnostics of err to w, one per line. Without diagnostics, the error
+// output of go list is printed. It returns an error referring to the printed output.
+func printGoListError(w io.Writer, err *module.GoListError) error {
+	if w == nil {
+		w = os.Stderr
+	}
+
+	var sb strings.Builder
+	switch {
+	case len(err.Diagnostics) > 0:
+		for _, d := range err.Diagnostics {
+			_, _ = fmt.Fprintf(&sb, "%s\n", strings.ReplaceAll(d.String(), "\n", "\n\t"))
 		}
+	case strings.TrimSpace(err.Stderr) != "":
+		_, _ = fmt.Fprintf(&sb, "%s\n", strings.TrimSpace(err.Stderr))
+	default:
+		return err
 	}
-	return &linkNodeError{
-		path: node.Segment,
-		err:  err,
+
+	if _, printErr := io.WriteString(w, sb.String()); printErr != nil {
+		return err
 	}
+	return printedGoListError{err}
 }
 
-func Nodes(dir string, nodes []Node) error {
-	for _, node := range nodes {
-		if err := linkNode(dir, node); err != nil {
-			return joinLinkNodeError(node, err)
-		}
+// goCommandValues returns the configuration of the go command that influences the listed modules.
+func goCommandValues(goCmd *module.GoCommandOptions) []string {
+	return append([]string{
+		"GOFLAGS=" + os.Getenv("GOFLAGS"),
+		"GOTOOLCHAIN=" + goCmd.GoToolchain,
+		"GOOS=" + goCmd.GOOS,
+		"GOARCH=" + goCmd.GOARCH,
+		"goflags=" + strings.Join(goCmd.GoFlags, " "),
+	}, goCmd.Env...)
+}
+
+func GoSrc(dstDir string, opts Options) error {
+	if opts.SrcDir == "" {
+		opts.SrcDir = "."
 	}
-	return nil
+
+	return lockedOwned(dstDir, opts, func() error {
+		r, err := newReconciler(dstDir, opts)
+		if err != nil {
+			return err
+		}
+		if err := r.own(opts); err != nil {
+			return err
+		}
+		if _, err := planGoSrc(r, opts); err != nil {
+			return err
+		}
+		return apply(r.plan(), r.jobs)
+	})
 }
 
-func linkNode(dir string, node Node) error {
-	dstDir := filepath.Join(dir, node.Segment)
+// planGoSrc plans linking the modules into GOPATH/src and returns the manifest describing them.
+func planGoSrc(r *reconciler, opts Options) (*Manifest, error) {
+	workFile, err := workFile(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error determining workspace: %w", err)
+	}
 
-	// If the node specifies a module and no children are present, we can take optimize and directly
-	// symlink the module directory to the destination directory.
-	if node.Module != nil && len(node.Children) == 0 {
-		srcDir := node.Module.Dir
+	goCmd, err := goCommandOptions(opts)
+	if err != nil {
+		return nil, err
+	}
 
-		if err := os.Symlink(srcDir, dstDir); err != nil {
-			return fmt.Errorf("error symlinking node: %w", err)
+	mods, err := readModules(opts, workFile, goCmd)
+	if err != nil {
+		var goListErr *module.GoListError
+		if errors.As(err, &goListErr) {
+			err = printGoListError(opts.Stderr, goListErr)
 		}
+		return nil, fmt.Errorf("error reading modules: %w", err)
 	}
 
-	if err := os.RemoveAll(dstDir); err != nil {
-		return err
+	if err := ModuleErrors(mods); err != nil {
+		return nil, fmt.Errorf("error loading modules:\n%w", err)
 	}
 
-	if err := os.Mkdir(dstDir, 0777); err != nil {
-		return err
+	mods = ResolveModuleDirs(mods)
+	if opts.Download {
+		mods, err = DownloadModulesWithoutDir(mods, module.InDir(opts.SrcDir), module.WithWorkFile(workFile), goCmd)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if node.Module != nil {
-		srcDir := node.Module.Dir
-		entries, err := os.ReadDir(srcDir)
-		if err != nil {
-			return err
+	mods = FilterModulesWithoutDir(mods)
+
+	mods, err = DeduplicateModules(mods)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := BuildModuleNodes(mods)
+	if err != nil {
+		return nil, fmt.Errorf("error building module tree: %w", err)
+	}
+
+	if opts.Atomic {
+		if opts.Merge {
+			return nil, fmt.Errorf("cannot use atomic mode together with merge mode")
 		}
+		if err := r.stage("src", nodes); err != nil {
+			return nil, err
+		}
+		return newManifest(opts, workFile, goCmd)
+	}
 
-		childNames := make(map[string]struct{}, len(node.Children))
-		for _, child := range node.Children {
-			childNames[child.Segment] = struct{}{}
+	exists, err := r.dir("src")
+	switch {
+	case errors.Is(err, errSkip):
+		// The conflicting GOPATH/src is kept, so there is nothing to link.
+	case err != nil:
+		return nil, err
+	default:
+		if err := r.nodes("src", nodes, exists); err != nil {
+			return nil, err
 		}
+	}
+	return newManifest(opts, workFile, goCmd)
+}
 
-		for _, entry := range entries {
-			// skip linking directories of the module hierarchy, they will be handled by a dedicated call
-			if _, ok := childNames[entry.Name()]; ok {
-				continue
-			}
+type linkNodeError struct {
+	path string
+	err  error
+}
 
-			srcPath := filepath.Join(srcDir, entry.Name())
-			dstPath := filepath.Join(dstDir, entry.Name())
-			if err := os.Symlink(srcPath, dstPath); err != nil {
-				return fmt.Errorf("error symlinking entry %s to %s: %w", srcPath, dstPath, err)
-			}
+func (l *linkNodeError) Error() string {
+	return fmt.Sprintf("[path %s]: %v", l.path, l.err)
+}
+
+func joinLinkNodeError(node Node, err error) error {
+	if linkNodeErr, ok := err.(*linkNodeError); ok {
+		return &linkNodeError{
+			path: path.Join(node.Segment, linkNodeErr.path),
+			err:  linkNodeErr.err,
 		}
 	}
-	return Nodes(dstDir, node.Children)
+	return &linkNodeError{
+		path: node.Segment,
+		err:  err,
+	}
+}
+
+// Nodes links the nodes into dir, replacing the previous contents of their directories. Other
+// entries of dir are kept. Unlike Link, Nodes does not check whether dir was created by vgopath.
+func Nodes(dir string, nodes []Node) error {
+	r := &reconciler{root: dir, jobs: newJobs(0)}
+	if err := r.linkNodes("", nodes, true); err != nil {
+		return err
+	}
+	return apply(r.plan(), r.jobs)
 }
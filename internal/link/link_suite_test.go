@@ -4,12 +4,30 @@
 package link_test
 
 import (
+	"os"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
+var _ = BeforeSuite(func() {
+	// Keep the module list cache of the tests out of the user cache directory.
+	cacheHome, err := os.MkdirTemp("", "cache")
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(os.RemoveAll, cacheHome)
+
+	origCacheHome, hadCacheHome := os.LookupEnv("XDG_CACHE_HOME")
+	Expect(os.Setenv("XDG_CACHE_HOME", cacheHome)).To(Succeed())
+	DeferCleanup(func() {
+		if hadCacheHome {
+			_ = os.Setenv("XDG_CACHE_HOME", origCacheHome)
+		} else {
+			_ = os.Unsetenv("XDG_CACHE_HOME")
+		}
+	})
+})
+
 func TestInternal(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Link Suite")
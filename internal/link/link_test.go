@@ -4,16 +4,22 @@
 package link_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"go/build"
+	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"slices"
+	"strconv"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/format"
 	"github.com/onsi/gomega/types"
+	"github.com/spf13/pflag"
 
 	. "github.com/ironcore-dev/vgopath/internal/link"
 	"github.com/ironcore-dev/vgopath/internal/module"
@@ -75,14 +81,16 @@ var _ = Describe("Internal", func() {
 
 	Describe("BuildModuleNodes", func() {
 		It("should correctly build the nodes", func() {
-			nodes, err := BuildModuleNodes([]module.Module{moduleA, moduleB, moduleB1, moduleB11, moduleB2, moduleC})
+			mods := []module.Module{moduleC, moduleB2, moduleB, moduleA, moduleB11, moduleB1}
+			nodes, err := BuildModuleNodes(mods)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(nodes).To(ConsistOf(
-				Node{
+			Expect(mods).To(Equal([]module.Module{moduleC, moduleB2, moduleB, moduleA, moduleB11, moduleB1}), "the modules must not be modified")
+			Expect(nodes).To(Equal([]Node{
+				{
 					Segment: "a",
 					Module:  &moduleA,
 				},
-				Node{
+				{
 					Segment: "example.org",
 					Children: []Node{
 						{
@@ -116,7 +124,7 @@ var _ = Describe("Internal", func() {
 						},
 					},
 				},
-			))
+			}))
 		})
 
 		It("should error on invalid module paths", func() {
@@ -130,6 +138,173 @@ var _ = Describe("Internal", func() {
 		})
 	})
 
+	Context("Lookup", func() {
+		var nodes []Node
+		BeforeEach(func() {
+			for _, mod := range []*module.Module{&moduleA, &moduleB, &moduleB1, &moduleB11, &moduleB2, &moduleC} {
+				mod.Dir = filepath.Join(tmpDir, mod.Dir)
+			}
+			moduleB2.Dir = filepath.Join(tmpDir, "elsewhere")
+
+			var err error
+			nodes, err = BuildModuleNodes([]module.Module{moduleA, moduleB, moduleB1, moduleB11, moduleB2, moduleC})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Describe("LookupImportPath", func() {
+			It("should return the module with the longest matching path", func() {
+				mod, dir, ok := LookupImportPath(nodes, "example.org/b/1/pkg/sub")
+				Expect(ok).To(BeTrue())
+				Expect(*mod).To(Equal(moduleB1))
+				Expect(dir).To(Equal(filepath.Join("pkg", "sub")))
+
+				mod, dir, ok = LookupImportPath(nodes, "example.org/b/1/1")
+				Expect(ok).To(BeTrue())
+				Expect(*mod).To(Equal(moduleB11))
+				Expect(dir).To(BeEmpty())
+			})
+
+			It("should report false if no module provides the import path", func() {
+				_, _, ok := LookupImportPath(nodes, "example.org/user/d")
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		Describe("ImportPathForDir", func() {
+			It("should return the import path of the deepest module directory", func() {
+				for dir, expected := range map[string]string{
+					filepath.Join(tmpDir, "example.org", "b", "1", "pkg"): "example.org/b/1/pkg",
+					filepath.Join(tmpDir, "elsewhere", "pkg"):             "example.org/b/2/pkg",
+					moduleA.Dir: "a",
+				} {
+					importPath, ok := ImportPathForDir(nodes, dir)
+					Expect(ok).To(BeTrue(), dir)
+					Expect(importPath).To(Equal(expected))
+				}
+			})
+
+			It("should report false for directories outside of modules or shadowed by a nested module", func() {
+				_, ok := ImportPathForDir(nodes, filepath.Join(tmpDir, "example.org", "user"))
+				Expect(ok).To(BeFalse())
+				_, ok = ImportPathForDir(nodes, filepath.Join(tmpDir, "example.org", "b", "2", "pkg"))
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		Describe("Walk", func() {
+			It("should yield the parents before their children", func() {
+				var importPaths []string
+				for importPath := range Walk(nodes) {
+					importPaths = append(importPaths, importPath)
+				}
+				Expect(importPaths).To(Equal([]string{
+					"a",
+					"example.org",
+					"example.org/b",
+					"example.org/b/1",
+					"example.org/b/1/1",
+					"example.org/b/2",
+					"example.org/user",
+					"example.org/user/c",
+				}))
+			})
+
+			It("should stop when the loop breaks", func() {
+				var importPaths []string
+				for importPath := range Walk(nodes) {
+					if importPath == "example.org/b/1" {
+						break
+					}
+					importPaths = append(importPaths, importPath)
+				}
+				Expect(importPaths).To(Equal([]string{"a", "example.org", "example.org/b"}))
+			})
+		})
+	})
+
+	Describe("Options", func() {
+		It("should not split --goflags on commas", func() {
+			var opts Options
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			opts.AddFlags(fs)
+			Expect(fs.Parse([]string{"--goflags", "-tags=a,b", "--goflags", "-mod=mod"})).To(Succeed())
+			Expect(opts.GoFlags).To(Equal([]string{"-tags=a,b", "-mod=mod"}))
+		})
+	})
+
+	Describe("DeduplicateModules", func() {
+		It("should prefer main modules over dependencies with the same path", func() {
+			workspaceB := module.Module{Path: moduleB.Path, Dir: filepath.Join("workspace", "b"), Main: true}
+
+			mods, err := DeduplicateModules([]module.Module{moduleA, moduleB, workspaceB, moduleC})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mods).To(Equal([]module.Module{moduleA, workspaceB, moduleC}))
+		})
+
+		It("should collapse modules pointing to the same directory", func() {
+			mods, err := DeduplicateModules([]module.Module{moduleA, moduleB, moduleB})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mods).To(Equal([]module.Module{moduleA, moduleB}))
+		})
+
+		It("should error if modules with the same path have different directories", func() {
+			_, err := DeduplicateModules([]module.Module{moduleB, {Path: moduleB.Path, Dir: "other"}})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("ResolveModuleDirs", func() {
+		It("should use the directory of the replacement if the module has none", func() {
+			replaced := module.Module{
+				Path:    moduleD.Path,
+				Replace: &module.Module{Path: "../d", Dir: filepath.Join("local", "d")},
+			}
+
+			mods := ResolveModuleDirs([]module.Module{moduleA, replaced})
+			Expect(mods).To(HaveLen(2))
+			Expect(mods[0]).To(Equal(moduleA))
+			Expect(mods[1].Dir).To(Equal(filepath.Join("local", "d")))
+			Expect(replaced.Dir).To(BeEmpty(), "should not modify the input")
+		})
+	})
+
+	Describe("ModuleErrors", func() {
+		It("should return nil if no module has an error", func() {
+			Expect(ModuleErrors([]module.Module{moduleA, moduleB})).To(Succeed())
+		})
+
+		It("should report every module error", func() {
+			err := ModuleErrors([]module.Module{
+				moduleA,
+				{Path: "example.org/e", Version: "v1.0.0", Error: &module.Error{Err: "unknown revision v1.0.0"}},
+				{Path: "example.org/f", Replace: &module.Module{Path: "../f", Error: &module.Error{Err: "no such directory"}}},
+			})
+			Expect(err).To(MatchError(And(
+				ContainSubstring("example.org/e@v1.0.0: unknown revision v1.0.0"),
+				ContainSubstring("example.org/f (replaced by ../f): no such directory"),
+			)))
+		})
+	})
+
+	Describe("DownloadModulesWithoutDir", func() {
+		It("should fill in the directory of the downloaded modules", func() {
+			moduleDV := module.Module{Path: moduleD.Path, Version: "v1.0.0"}
+			goModDownload := func(args ...string) *exec.Cmd {
+				Expect(args).To(Equal([]string{"mod", "download", "-json", "example.org/d@v1.0.0"}))
+				return exec.Command("echo", `{"Path": "example.org/d", "Version": "v1.0.0", "Dir": "/tmp/example.org/d@v1.0.0"}`)
+			}
+
+			mods, err := DownloadModulesWithoutDir(
+				[]module.Module{moduleA, moduleB, moduleDV},
+				&module.DownloadOptions{Command: goModDownload},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			moduleDV.Dir = "/tmp/example.org/d@v1.0.0"
+			Expect(mods).To(Equal([]module.Module{moduleA, moduleB, moduleDV}))
+		})
+	})
+
 	Describe("FilterModulesWithoutDir", func() {
 		It("should correctly filter the modules", func() {
 			mods := FilterModulesWithoutDir([]module.Module{moduleA, moduleB, moduleD})
@@ -170,6 +345,803 @@ var _ = Describe("Internal", func() {
 					filepath.Join("example.org", "b", "2", "go.mod"):      BeASymlinkTo(filepath.Join(moduleB2.Dir, "go.mod")),
 				}))
 			})
+
+			It("should only change the entries that differ when relinking", func() {
+				Expect(makeModules(srcGopathDir, &moduleB, &moduleB1, &moduleB2)).NotTo(HaveOccurred())
+
+				nodes, err := BuildModuleNodes([]module.Module{moduleB, moduleB1, moduleB2})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(Nodes(dstGopathDir, nodes)).To(Succeed())
+
+				unchanged := filepath.Join(dstGopathDir, "example.org", "b", "go.mod")
+				unchangedBefore, err := os.Lstat(unchanged)
+				Expect(err).NotTo(HaveOccurred())
+
+				By("adding a file, moving a module and dropping another one")
+				Expect(os.WriteFile(filepath.Join(moduleB.Dir, "b.go"), []byte("package b\n"), 0666)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(dstGopathDir, "example.org", "stale"), nil, 0666)).To(Succeed())
+				movedB1 := moduleB1
+				movedB1.Dir = filepath.Join(tmpDir, "moved")
+				Expect(makeModules("", &movedB1)).To(Succeed())
+
+				nodes, err = BuildModuleNodes([]module.Module{moduleB, movedB1})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(Nodes(dstGopathDir, nodes)).To(Succeed())
+
+				Expect(dstGopathDir).To(HaveEntries(map[string]types.GomegaMatcher{
+					filepath.Join("example.org", "b", "go.mod"):      BeASymlinkTo(filepath.Join(moduleB.Dir, "go.mod")),
+					filepath.Join("example.org", "b", "b.go"):        BeASymlinkTo(filepath.Join(moduleB.Dir, "b.go")),
+					filepath.Join("example.org", "b", "1", "go.mod"): BeASymlinkTo(filepath.Join(movedB1.Dir, "go.mod")),
+					// Without the nested module, its directory is a regular part of the parent module.
+					filepath.Join("example.org", "b", "2"): BeASymlinkTo(filepath.Join(moduleB.Dir, "2")),
+				}))
+				Expect(filepath.Join(dstGopathDir, "example.org", "stale")).NotTo(BeAnExistingFile())
+
+				By("keeping the entries that did not change")
+				unchangedAfter, err := os.Lstat(unchanged)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.SameFile(unchangedBefore, unchangedAfter)).To(BeTrue())
+			})
+
+			It("should keep the entries of dir that do not belong to a node", func() {
+				Expect(makeModules(srcGopathDir, &moduleA)).NotTo(HaveOccurred())
+				Expect(os.WriteFile(filepath.Join(dstGopathDir, "foreign"), nil, 0666)).To(Succeed())
+
+				nodes, err := BuildModuleNodes([]module.Module{moduleA})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(Nodes(dstGopathDir, nodes)).To(Succeed())
+
+				Expect(filepath.Join(dstGopathDir, "foreign")).To(BeAnExistingFile())
+				Expect(filepath.Join(dstGopathDir, "a", "go.mod")).To(BeASymlinkTo(filepath.Join(moduleA.Dir, "go.mod")))
+			})
+
+			It("should report the error of the first failing node", func() {
+				Expect(makeModules(srcGopathDir, &moduleB)).NotTo(HaveOccurred())
+
+				var mods []module.Module
+				for i := range 32 {
+					mods = append(mods, module.Module{Path: fmt.Sprintf("example.org/m%02d", i), Dir: filepath.Join(tmpDir, "missing", strconv.Itoa(i))})
+				}
+				nodes, err := BuildModuleNodes(append(mods, moduleB))
+				Expect(err).NotTo(HaveOccurred())
+
+				for range 10 {
+					err := Nodes(dstGopathDir, nodes)
+					Expect(err).To(MatchError(HavePrefix("[path example.org/m00]: ")))
+				}
+			})
+
+			It("should replace entries of a different type", func() {
+				Expect(makeModules(srcGopathDir, &moduleB)).NotTo(HaveOccurred())
+				Expect(os.MkdirAll(filepath.Join(dstGopathDir, "example.org", "b", "go.mod"), 0777)).To(Succeed())
+
+				nodes, err := BuildModuleNodes([]module.Module{moduleB})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(Nodes(dstGopathDir, nodes)).To(Succeed())
+
+				Expect(dstGopathDir).To(HaveEntries(map[string]types.GomegaMatcher{
+					filepath.Join("example.org", "b", "go.mod"): BeASymlinkTo(filepath.Join(moduleB.Dir, "go.mod")),
+				}))
+			})
+		})
+
+		Describe("GoSrc", func() {
+			It("should list the modules with the configured go command", func() {
+				Expect(makeModules(srcGopathDir, &moduleA)).NotTo(HaveOccurred())
+
+				goBinary := filepath.Join(tmpDir, "go")
+				Expect(os.WriteFile(goBinary, []byte(`#!/bin/sh
+[ "$GOOS" = plan9 ] && [ "$GOFLAGS" = "-modfile=`+filepath.Join(tmpDir, "tools.mod")+`" ] || exit 1
+echo '{"Path": "`+moduleA.Path+`", "Dir": "`+moduleA.Dir+`"}'
+`), 0755)).To(Succeed())
+				defer setEnvAndRevert("GOFLAGS", "")()
+
+				Expect(GoSrc(dstGopathDir, Options{
+					SrcDir:   tmpDir,
+					WorkFile: module.GoWorkOff,
+					GoBinary: goBinary,
+					ModFile:  filepath.Join(tmpDir, "tools.mod"),
+					GOOS:     "plan9",
+				})).To(Succeed())
+				Expect(filepath.Join(dstGopathDir, "src", "a", "go.mod")).To(BeASymlinkTo(filepath.Join(moduleA.Dir, "go.mod")))
+			})
+
+			It("should cache the go list results", func() {
+				Expect(makeModules(srcGopathDir, &moduleA)).NotTo(HaveOccurred())
+				Expect(os.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module a\n"), 0666)).To(Succeed())
+
+				invocations := filepath.Join(tmpDir, "invocations")
+				goBinary := filepath.Join(tmpDir, "go")
+				Expect(os.WriteFile(goBinary, []byte(`#!/bin/sh
+if [ "$1" = env ]; then echo go1.99.0; exit 0; fi
+echo "$*" >> `+invocations+`
+echo '{"Path": "`+moduleA.Path+`", "Dir": "`+moduleA.Dir+`", "Main": true}'
+`), 0755)).To(Succeed())
+
+				opts := Options{SrcDir: tmpDir, WorkFile: module.GoWorkOff, GoBinary: goBinary}
+				Expect(GoSrc(dstGopathDir, opts)).To(Succeed())
+				Expect(GoSrc(dstGopathDir, opts)).To(Succeed())
+				Expect(os.ReadFile(invocations)).To(Equal([]byte("list -m -json all\n")))
+
+				opts.NoCache = true
+				Expect(GoSrc(dstGopathDir, opts)).To(Succeed())
+				Expect(os.ReadFile(invocations)).To(Equal([]byte("list -m -json all\nlist -m -json all\n")))
+
+				By("invalidating the cache once a module directory is gone")
+				opts.NoCache = false
+				Expect(os.RemoveAll(moduleA.Dir)).To(Succeed())
+				Expect(GoSrc(dstGopathDir, opts)).NotTo(Succeed())
+				Expect(os.ReadFile(invocations)).To(Equal([]byte("list -m -json all\nlist -m -json all\nlist -m -json all\n")))
+			})
+
+			It("should print the diagnostics of a failing go list call", func() {
+				goBinary := filepath.Join(tmpDir, "go")
+				Expect(os.WriteFile(goBinary, []byte(`#!/bin/sh
+echo 'go: downloading example.org/a v1.0.0' >&2
+echo 'go: example.org/b@v1.2.3: missing go.sum entry for go.mod file; to add it:' >&2
+printf '\tgo mod download example.org/b\n' >&2
+exit 1
+`), 0755)).To(Succeed())
+
+				var stderr bytes.Buffer
+				err := GoSrc(dstGopathDir, Options{
+					SrcDir:   tmpDir,
+					WorkFile: module.GoWorkOff,
+					GoBinary: goBinary,
+					NoCache:  true,
+					Stderr:   &stderr,
+				})
+				Expect(err).To(MatchError("error reading modules: go list failed with exit code 1, see the errors above"))
+
+				var goListErr *module.GoListError
+				Expect(errors.As(err, &goListErr)).To(BeTrue())
+				Expect(goListErr.ExitCode).To(Equal(1))
+				Expect(stderr.String()).To(Equal("example.org/b@v1.2.3: missing go.sum entry for go.mod file; to add it:\n\tgo mod download example.org/b\n"))
+			})
+
+			It("should link the modules read from a file", func() {
+				Expect(makeModules(srcGopathDir, &moduleA)).NotTo(HaveOccurred())
+
+				modulesFile := filepath.Join(tmpDir, "modules.json")
+				Expect(os.WriteFile(modulesFile, []byte(`{"Path": "`+moduleA.Path+`", "Dir": "`+moduleA.Dir+`", "Main": true}`), 0666)).To(Succeed())
+
+				Expect(GoSrc(dstGopathDir, Options{ModulesFrom: modulesFile, GoBinary: "/does/not/exist"})).To(Succeed())
+				Expect(filepath.Join(dstGopathDir, "src", "a", "go.mod")).To(BeASymlinkTo(filepath.Join(moduleA.Dir, "go.mod")))
+			})
+
+			It("should error on invalid environment variables", func() {
+				Expect(GoSrc(dstGopathDir, Options{Env: []string{"FOO"}})).To(MatchError(ContainSubstring(`invalid environment variable "FOO"`)))
+			})
+
+			It("should error if an alternate go.mod file is used in offline mode", func() {
+				Expect(GoSrc(dstGopathDir, Options{Offline: true, ModFile: "tools.mod"})).To(HaveOccurred())
+			})
+		})
+
+		Describe("PlanLink", func() {
+			It("should plan the changes without applying them", func() {
+				Expect(makeModules(srcGopathDir, &moduleA)).NotTo(HaveOccurred())
+				Expect(os.WriteFile(filepath.Join(dstGopathDir, MarkerFile), nil, 0666)).To(Succeed())
+				Expect(os.Mkdir(filepath.Join(dstGopathDir, "src"), 0777)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(dstGopathDir, "src", "stale"), nil, 0666)).To(Succeed())
+
+				modulesFile := filepath.Join(tmpDir, "modules.json")
+				Expect(os.WriteFile(modulesFile, []byte(`{"Path": "`+moduleA.Path+`", "Dir": "`+moduleA.Dir+`", "Main": true}`), 0666)).To(Succeed())
+				opts := Options{ModulesFrom: modulesFile, SkipGoBin: true, SkipGoPkg: true}
+
+				plan, err := PlanLink(dstGopathDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(plan.DstDir).To(Equal(dstGopathDir))
+				Expect(plan.Ops).To(Equal([]Op{
+					{Kind: OpRemove, Destination: filepath.Join("src", "stale")},
+					{Kind: OpMkdir, Destination: filepath.Join("src", "a")},
+					{Kind: OpSymlink, Source: filepath.Join(moduleA.Dir, "go.mod"), Destination: filepath.Join("src", "a", "go.mod")},
+				}))
+				Expect(filepath.Join(dstGopathDir, "src", "stale")).To(BeAnExistingFile())
+
+				By("applying the plan")
+				Expect(Apply(plan)).To(Succeed())
+				Expect(filepath.Join(dstGopathDir, "src", "stale")).NotTo(BeAnExistingFile())
+				Expect(filepath.Join(dstGopathDir, "src", "a", "go.mod")).To(BeASymlinkTo(filepath.Join(moduleA.Dir, "go.mod")))
+
+				By("planning nothing once applied")
+				plan, err = PlanLink(dstGopathDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(plan.Ops).To(BeEmpty())
+			})
+		})
+
+		Describe("Marker", func() {
+			var opts Options
+			BeforeEach(func() {
+				Expect(makeModules(srcGopathDir, &moduleB)).NotTo(HaveOccurred())
+				modulesFile := filepath.Join(tmpDir, "modules.json")
+				Expect(os.WriteFile(modulesFile, []byte(`{"Path": "`+moduleB.Path+`", "Dir": "`+moduleB.Dir+`"}`), 0666)).To(Succeed())
+				opts = Options{ModulesFrom: modulesFile, SkipGoBin: true, SkipGoPkg: true}
+			})
+
+			It("should mark an empty directory and keep linking into it", func() {
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+				Expect(IsMarked(dstGopathDir)).To(BeTrue())
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+			})
+
+			It("should refuse to link into a non-empty directory not created by vgopath", func() {
+				Expect(os.MkdirAll(filepath.Join(dstGopathDir, "src", "example.org", "work"), 0777)).To(Succeed())
+
+				Expect(os.WriteFile(filepath.Join(dstGopathDir, "notes.txt"), []byte("notes\n"), 0666)).To(Succeed())
+				before := snapshotDir(dstGopathDir)
+
+				Expect(Link(dstGopathDir, opts)).To(MatchError(ContainSubstring("not created by vgopath")))
+				_, err := LinkShared(dstGopathDir, opts)
+				Expect(err).To(MatchError(ContainSubstring("not created by vgopath")))
+				Expect(GoBin(dstGopathDir)).To(MatchError(ContainSubstring("not created by vgopath")))
+				Expect(Clean(dstGopathDir, false)).To(MatchError(ContainSubstring("not created by vgopath")))
+				_, err = Verify(dstGopathDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(snapshotDir(dstGopathDir)).To(Equal(before), "a refused run must not touch the directory")
+
+				By("linking with force")
+				opts.Force = true
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+				Expect(IsMarked(dstGopathDir)).To(BeTrue())
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "work")).NotTo(BeADirectory())
+			})
+
+			It("should adopt a tree created by a vgopath version without marker", func() {
+				defer setEnvAndRevert("GOMODCACHE", srcGopathDir)()
+				Expect(os.MkdirAll(filepath.Join(dstGopathDir, "src", "example.org"), 0777)).To(Succeed())
+				Expect(os.Symlink(moduleB.Dir, filepath.Join(dstGopathDir, "src", "example.org", "b"))).To(Succeed())
+				Expect(os.Symlink(tmpDir, filepath.Join(dstGopathDir, "bin"))).To(Succeed())
+
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+				Expect(IsMarked(dstGopathDir)).To(BeTrue())
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "b", "go.mod")).To(BeASymlinkTo(filepath.Join(moduleB.Dir, "go.mod")))
+			})
+
+			It("should name the entry and --force when refusing a tree with foreign links", func() {
+				defer setEnvAndRevert("GOMODCACHE", srcGopathDir)()
+				Expect(os.MkdirAll(filepath.Join(dstGopathDir, "src", "example.org"), 0777)).To(Succeed())
+				Expect(os.Symlink(tmpDir, filepath.Join(dstGopathDir, "src", "example.org", "b"))).To(Succeed())
+
+				Expect(Link(dstGopathDir, opts)).To(MatchError(And(
+					ContainSubstring(filepath.Join("src", "example.org", "b")+" points outside of the module cache and the project"),
+					ContainSubstring("use --force"),
+				)))
+				Expect(IsMarked(dstGopathDir)).To(BeFalse())
+			})
+
+			It("should only clean the entries created by vgopath", func() {
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(dstGopathDir, "notes.txt"), nil, 0666)).To(Succeed())
+
+				Expect(Clean(dstGopathDir, false)).To(Succeed())
+				entries, err := os.ReadDir(dstGopathDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(ConsistOf(HaveField("Name()", "notes.txt"), HaveField("Name()", LockFile)))
+
+				By("refusing to clean an unmarked directory")
+				Expect(os.Mkdir(filepath.Join(dstGopathDir, "src"), 0777)).To(Succeed())
+				Expect(Clean(dstGopathDir, false)).To(MatchError(ContainSubstring("not created by vgopath")))
+				Expect(filepath.Join(dstGopathDir, "src")).To(BeADirectory())
+				Expect(Clean(dstGopathDir, true)).To(Succeed())
+				Expect(filepath.Join(dstGopathDir, "src")).NotTo(BeADirectory())
+			})
+		})
+
+		Describe("Merge", func() {
+			var (
+				modulesFile string
+				opts        Options
+			)
+			BeforeEach(func() {
+				Expect(makeModules(srcGopathDir, &moduleB)).NotTo(HaveOccurred())
+				Expect(os.WriteFile(filepath.Join(moduleB.Dir, "b.go"), []byte("package b\n"), 0666)).To(Succeed())
+				modulesFile = filepath.Join(tmpDir, "modules.json")
+				Expect(os.WriteFile(modulesFile, []byte(`{"Path": "`+moduleB.Path+`", "Dir": "`+moduleB.Dir+`"}`), 0666)).To(Succeed())
+				opts = Options{ModulesFrom: modulesFile, SkipGoPkg: true, Merge: true}
+
+				By("setting up an existing GOPATH")
+				srcGoBinDir := filepath.Join(tmpDir, "gobin")
+				Expect(os.Mkdir(srcGoBinDir, 0777)).To(Succeed())
+				DeferCleanup(setEnvAndRevert("GOBIN", srcGoBinDir))
+				Expect(os.MkdirAll(filepath.Join(dstGopathDir, "bin"), 0777)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(dstGopathDir, "bin", "tool"), nil, 0777)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(dstGopathDir, "src", "example.org", "hand"), 0777)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(dstGopathDir, "src", "example.org", "hand", "hand.go"), nil, 0666)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(dstGopathDir, "src", "example.org", "b"), 0777)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(dstGopathDir, "src", "example.org", "b", "go.mod"), nil, 0666)).To(Succeed())
+			})
+
+			It("should fail on conflicts by default", func() {
+				Expect(Link(dstGopathDir, opts)).To(MatchError(ContainSubstring("exists and was not created by vgopath")))
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "b", "go.mod")).To(BeARegularFile())
+			})
+
+			It("should keep foreign and conflicting entries when skipping", func() {
+				opts.Conflict = string(ConflictSkip)
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+
+				Expect(dstGopathDir).To(HaveEntries(map[string]types.GomegaMatcher{
+					filepath.Join("bin", "tool"):                           BeARegularFile(),
+					filepath.Join("src", "example.org", "hand", "hand.go"): BeARegularFile(),
+					filepath.Join("src", "example.org", "b", "go.mod"):     BeARegularFile(),
+					filepath.Join("src", "example.org", "b", "b.go"):       BeASymlinkTo(filepath.Join(moduleB.Dir, "b.go")),
+				}))
+				manifest, err := ReadManifest(dstGopathDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest.Merged).To(BeTrue())
+				Expect(manifest.Modules).To(ConsistOf(HaveField("Entries", []string{filepath.Join("src", "example.org", "b", "b.go")})))
+
+				By("refusing to link again without merge")
+				Expect(Link(dstGopathDir, Options{ModulesFrom: modulesFile, SkipGoBin: true, SkipGoPkg: true})).To(MatchError(ContainSubstring("use --merge")))
+
+				By("removing only the entries of dropped modules")
+				Expect(os.WriteFile(modulesFile, nil, 0666)).To(Succeed())
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "b", "b.go")).NotTo(BeAnExistingFile())
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "b", "go.mod")).To(BeARegularFile())
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "hand", "hand.go")).To(BeARegularFile())
+			})
+
+			It("should replace conflicting entries when overriding", func() {
+				opts.Conflict = string(ConflictOverride)
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+
+				Expect(dstGopathDir).To(HaveEntries(map[string]types.GomegaMatcher{
+					"bin": BeASymlinkTo(filepath.Join(tmpDir, "gobin")),
+					filepath.Join("src", "example.org", "hand", "hand.go"): BeARegularFile(),
+					filepath.Join("src", "example.org", "b", "go.mod"):     BeASymlinkTo(filepath.Join(moduleB.Dir, "go.mod")),
+				}))
+
+				By("cleaning only the entries of the modules")
+				Expect(Clean(dstGopathDir, false)).To(Succeed())
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "b")).NotTo(BeAnExistingFile())
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "hand", "hand.go")).To(BeARegularFile())
+				Expect(filepath.Join(dstGopathDir, "bin")).NotTo(BeAnExistingFile())
+			})
+
+			It("should keep merging into the GOPATH/bin it created", func() {
+				opts.Conflict = string(ConflictOverride)
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+				manifest, err := ReadManifest(dstGopathDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest.Links).To(Equal([]string{"bin"}))
+
+				By("relinking a changed GOBIN with the default conflict policy")
+				otherGoBinDir := filepath.Join(tmpDir, "other-gobin")
+				Expect(os.Mkdir(otherGoBinDir, 0777)).To(Succeed())
+				defer setEnvAndRevert("GOBIN", otherGoBinDir)()
+				opts.Conflict = ""
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+				Expect(filepath.Join(dstGopathDir, "bin")).To(BeASymlinkTo(otherGoBinDir))
+			})
+
+			It("should not clean a GOPATH/bin symlink it did not create", func() {
+				Expect(os.RemoveAll(filepath.Join(dstGopathDir, "bin"))).To(Succeed())
+				Expect(os.Symlink(filepath.Join(tmpDir, "gobin"), filepath.Join(dstGopathDir, "bin"))).To(Succeed())
+				opts.Conflict = string(ConflictSkip)
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+				manifest, err := ReadManifest(dstGopathDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest.Links).To(BeEmpty())
+
+				Expect(Clean(dstGopathDir, false)).To(Succeed())
+				Expect(filepath.Join(dstGopathDir, "bin")).To(BeASymlinkTo(filepath.Join(tmpDir, "gobin")))
+			})
+
+			It("should error on invalid conflict policies", func() {
+				opts.Conflict = "ignore"
+				Expect(Link(dstGopathDir, opts)).To(MatchError(ContainSubstring("invalid conflict policy")))
+			})
+		})
+
+		Describe("Lock", func() {
+			var opts Options
+			BeforeEach(func() {
+				Expect(makeModules(srcGopathDir, &moduleB)).NotTo(HaveOccurred())
+				modulesFile := filepath.Join(tmpDir, "modules.json")
+				Expect(os.WriteFile(modulesFile, []byte(`{"Path": "`+moduleB.Path+`", "Dir": "`+moduleB.Dir+`"}`), 0666)).To(Succeed())
+				opts = Options{ModulesFrom: modulesFile, SkipGoBin: true, SkipGoPkg: true}
+			})
+
+			linkAsync := func() chan error {
+				done := make(chan error, 1)
+				go func() { done <- Link(dstGopathDir, opts) }()
+				return done
+			}
+
+			It("should wait for the exclusive lock", func() {
+				l, err := LockExclusive(dstGopathDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				done := linkAsync()
+				Consistently(done, "200ms").ShouldNot(Receive())
+				Expect(filepath.Join(dstGopathDir, "src")).NotTo(BeADirectory())
+
+				Expect(l.Unlock()).To(Succeed())
+				Eventually(done).Should(Receive(BeNil()))
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "b", "go.mod")).To(BeASymlinkTo(filepath.Join(moduleB.Dir, "go.mod")))
+			})
+
+			It("should keep a shared lock after linking until it is released", func() {
+				l, err := LinkShared(dstGopathDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+
+				By("allowing other shared locks")
+				other, err := LockShared(dstGopathDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(other.Unlock()).To(Succeed())
+
+				By("making a relink wait")
+				done := linkAsync()
+				Consistently(done, "200ms").ShouldNot(Receive())
+
+				Expect(l.Unlock()).To(Succeed())
+				Eventually(done).Should(Receive(BeNil()))
+			})
+		})
+
+		Describe("Atomic", func() {
+			var (
+				modulesFile string
+				opts        Options
+			)
+			BeforeEach(func() {
+				Expect(makeModules(srcGopathDir, &moduleA, &moduleB)).NotTo(HaveOccurred())
+				modulesFile = filepath.Join(tmpDir, "modules.json")
+				Expect(os.WriteFile(modulesFile, []byte(`{"Path": "`+moduleA.Path+`", "Dir": "`+moduleA.Dir+`"}`), 0666)).To(Succeed())
+				opts = Options{ModulesFrom: modulesFile, SkipGoBin: true, SkipGoPkg: true, Atomic: true}
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+			})
+
+			It("should swap in the new tree", func() {
+				Expect(os.WriteFile(modulesFile, []byte(`{"Path": "`+moduleB.Path+`", "Dir": "`+moduleB.Dir+`"}`), 0666)).To(Succeed())
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+
+				entries, err := os.ReadDir(filepath.Join(dstGopathDir, "src"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(ConsistOf(HaveField("Name()", "example.org")))
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "b", "go.mod")).To(BeASymlinkTo(filepath.Join(moduleB.Dir, "go.mod")))
+				Expect(filepath.Join(dstGopathDir, "src"+".vgopath-staging")).NotTo(BeAnExistingFile())
+
+				manifest, err := ReadManifest(dstGopathDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest.Modules).To(ConsistOf(HaveField("Entries", []string{filepath.Join("src", "example.org", "b", "go.mod")})))
+			})
+
+			It("should keep the old tree if applying fails", func() {
+				Expect(os.WriteFile(modulesFile, []byte(`{"Path": "`+moduleB.Path+`", "Dir": "`+moduleB.Dir+`"}`), 0666)).To(Succeed())
+				opts.Mode = string(ModeCopy)
+				plan, err := PlanLink(dstGopathDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(os.Remove(filepath.Join(moduleB.Dir, "go.mod"))).To(Succeed())
+				Expect(Apply(plan)).To(HaveOccurred())
+
+				Expect(filepath.Join(dstGopathDir, "src", "a", "go.mod")).To(BeASymlinkTo(filepath.Join(moduleA.Dir, "go.mod")))
+				Expect(filepath.Join(dstGopathDir, "src", "example.org")).NotTo(BeAnExistingFile())
+				Expect(filepath.Join(dstGopathDir, "src"+".vgopath-staging")).NotTo(BeAnExistingFile())
+			})
+
+			It("should not be combined with merge mode", func() {
+				opts.Merge = true
+				Expect(Link(dstGopathDir, opts)).To(MatchError(ContainSubstring("cannot use atomic mode together with merge mode")))
+			})
+		})
+
+		Describe("Manifest", func() {
+			It("should describe the entries created for every module", func() {
+				moduleB.Version = "v1.0.0"
+				Expect(makeModules(srcGopathDir, &moduleA, &moduleB, &moduleB1)).NotTo(HaveOccurred())
+				Expect(os.WriteFile(filepath.Join(moduleB.Dir, "b.go"), []byte("package b\n"), 0666)).To(Succeed())
+
+				modulesFile := filepath.Join(tmpDir, "modules.json")
+				Expect(os.WriteFile(modulesFile, []byte(`
+{"Path": "`+moduleA.Path+`", "Dir": "`+moduleA.Dir+`", "Main": true}
+{"Path": "`+moduleB.Path+`", "Version": "v1.0.0", "Dir": "`+moduleB.Dir+`"}
+{"Path": "`+moduleB1.Path+`", "Dir": "`+moduleB1.Dir+`"}
+`), 0666)).To(Succeed())
+				srcDir := filepath.Join(tmpDir, "project")
+				Expect(os.Mkdir(srcDir, 0777)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(srcDir, "go.mod"), []byte("module a\n"), 0666)).To(Succeed())
+				opts := Options{SrcDir: srcDir, ModulesFrom: modulesFile, MainMode: string(ModeCopy), SkipGoBin: true, SkipGoPkg: true}
+
+				Expect(ReadManifest(dstGopathDir)).To(BeNil())
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+
+				manifest, err := ReadManifest(dstGopathDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest.SrcDir).To(Equal(srcDir))
+				Expect(manifest.VgopathVersion).NotTo(BeEmpty())
+				Expect(manifest.InputsHash).NotTo(BeEmpty())
+				Expect(manifest.Modules).To(Equal([]ManifestModule{
+					{Path: moduleA.Path, Dir: moduleA.Dir, Mode: ModeCopy, Entries: []string{filepath.Join("src", "a", "go.mod")}},
+					{Path: moduleB.Path, Version: "v1.0.0", Dir: moduleB.Dir, Mode: ModeSymlink, Entries: []string{
+						filepath.Join("src", "example.org", "b", "b.go"),
+						filepath.Join("src", "example.org", "b", "go.mod"),
+					}},
+					{Path: moduleB1.Path, Dir: moduleB1.Dir, Mode: ModeSymlink, Entries: []string{filepath.Join("src", "example.org", "b", "1", "go.mod")}},
+				}))
+
+				By("changing the inputs hash with the go.mod file")
+				Expect(os.WriteFile(filepath.Join(srcDir, "go.mod"), []byte("module a\n\ngo 1.22\n"), 0666)).To(Succeed())
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+				updated, err := ReadManifest(dstGopathDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(updated.InputsHash).NotTo(Equal(manifest.InputsHash))
+				Expect(updated.Modules).To(Equal(manifest.Modules))
+
+				By("keeping the modules and the inputs hash if GOPATH/src is skipped")
+				Expect(os.WriteFile(filepath.Join(srcDir, "go.mod"), []byte("module a\n\ngo 1.23\n"), 0666)).To(Succeed())
+				skipSrcOpts := opts
+				skipSrcOpts.SkipGoSrc = true
+				Expect(Link(dstGopathDir, skipSrcOpts)).To(Succeed())
+				skipped, err := ReadManifest(dstGopathDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(skipped.SrcDir).To(Equal(srcDir))
+				Expect(skipped.InputsHash).To(Equal(updated.InputsHash))
+				Expect(skipped.Modules).To(Equal(updated.Modules))
+			})
+		})
+
+		Describe("Verify", func() {
+			var (
+				modulesFile string
+				opts        Options
+			)
+			writeModules := func(mods ...module.Module) {
+				var data []byte
+				for _, mod := range mods {
+					data = append(data, `{"Path": "`+mod.Path+`", "Version": "`+mod.Version+`", "Dir": "`+mod.Dir+`"}`...)
+				}
+				Expect(os.WriteFile(modulesFile, data, 0666)).To(Succeed())
+			}
+			BeforeEach(func() {
+				Expect(makeModules(srcGopathDir, &moduleA, &moduleB, &moduleC)).NotTo(HaveOccurred())
+				modulesFile = filepath.Join(tmpDir, "modules.json")
+				opts = Options{ModulesFrom: modulesFile, SkipGoBin: true, SkipGoPkg: true}
+			})
+
+			It("should report a tree without manifest", func() {
+				writeModules(moduleA)
+				report, err := Verify(dstGopathDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(report.NoManifest).To(BeTrue())
+				Expect(report.Outdated).To(ContainElement("src"))
+				Expect(report.OK()).To(BeFalse())
+			})
+
+			It("should report the differences to the project", func() {
+				moduleB.Version = "v1.0.0"
+				writeModules(moduleA, moduleB)
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+
+				report, err := Verify(dstGopathDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(report.OK()).To(BeTrue(), "%+v", report)
+
+				By("changing the project and the tree")
+				updatedB := moduleB
+				updatedB.Version = "v1.1.0"
+				writeModules(updatedB, moduleC)
+				Expect(os.WriteFile(filepath.Join(dstGopathDir, "src", "foreign"), nil, 0666)).To(Succeed())
+				Expect(os.Symlink(filepath.Join(tmpDir, "missing"), filepath.Join(dstGopathDir, "src", "dangling"))).To(Succeed())
+
+				report, err = Verify(dstGopathDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(report.OK()).To(BeFalse())
+				Expect(report.AddedModules).To(ConsistOf(HaveField("Path", moduleC.Path)))
+				Expect(report.RemovedModules).To(ConsistOf(HaveField("Path", moduleA.Path)))
+				Expect(report.ChangedModules).To(Equal([]ModuleChange{{
+					Path:       moduleB.Path,
+					OldVersion: "v1.0.0",
+					NewVersion: "v1.1.0",
+					OldDir:     moduleB.Dir,
+					NewDir:     moduleB.Dir,
+				}}))
+				Expect(report.Dangling).To(Equal([]string{filepath.Join("src", "dangling")}))
+				Expect(report.Foreign).To(ConsistOf(
+					filepath.Join("src", "a"),
+					filepath.Join("src", "dangling"),
+					filepath.Join("src", "foreign"),
+				))
+				Expect(report.Outdated).To(ConsistOf(
+					filepath.Join("src", "example.org", "user"),
+					filepath.Join("src", "example.org", "user", "c"),
+					filepath.Join("src", "example.org", "user", "c", "go.mod"),
+				))
+			})
+		})
+
+		Describe("Jobs", func() {
+			It("should plan the same changes regardless of the number of jobs", func() {
+				Expect(makeModules(srcGopathDir, &moduleA, &moduleB, &moduleB1, &moduleB11, &moduleB2)).NotTo(HaveOccurred())
+				Expect(os.WriteFile(filepath.Join(moduleB.Dir, "b.go"), []byte("package b\n"), 0666)).To(Succeed())
+
+				var modulesJSON []byte
+				for _, mod := range []module.Module{moduleA, moduleB, moduleB1, moduleB11, moduleB2} {
+					modulesJSON = append(modulesJSON, `{"Path": "`+mod.Path+`", "Dir": "`+mod.Dir+`"}`...)
+				}
+				modulesFile := filepath.Join(tmpDir, "modules.json")
+				Expect(os.WriteFile(modulesFile, modulesJSON, 0666)).To(Succeed())
+				opts := Options{ModulesFrom: modulesFile, SkipGoBin: true, SkipGoPkg: true, Jobs: 1}
+
+				sequential, err := PlanLink(dstGopathDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+
+				opts.Jobs = 8
+				concurrent, err := PlanLink(dstGopathDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(concurrent).To(Equal(sequential))
+
+				By("linking concurrently")
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "b", "1", "1", "go.mod")).To(BeASymlinkTo(filepath.Join(moduleB11.Dir, "go.mod")))
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "b", "b.go")).To(BeASymlinkTo(filepath.Join(moduleB.Dir, "b.go")))
+
+				plan, err := PlanLink(dstGopathDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(plan.Ops).To(BeEmpty())
+			})
+		})
+
+		Describe("RelativeLinks", func() {
+			It("should link relative to the resolved location of the symlinks", func() {
+				Expect(makeModules(srcGopathDir, &moduleB)).NotTo(HaveOccurred())
+				modulesFile := filepath.Join(tmpDir, "modules.json")
+				Expect(os.WriteFile(modulesFile, []byte(`{"Path": "`+moduleB.Path+`", "Dir": "`+moduleB.Dir+`"}`), 0666)).To(Succeed())
+
+				By("linking through a symlinked parent directory")
+				realDir := filepath.Join(tmpDir, "real")
+				Expect(os.MkdirAll(filepath.Join(realDir, "gopath"), 0777)).To(Succeed())
+				Expect(os.Symlink(realDir, filepath.Join(tmpDir, "linked"))).To(Succeed())
+				dst := filepath.Join(tmpDir, "linked", "gopath")
+
+				defer setEnvAndRevert("GOBIN", filepath.Join(srcGopathDir, "bin"))()
+				Expect(Link(dst, Options{ModulesFrom: modulesFile, RelativeLinks: true, SkipGoPkg: true})).To(Succeed())
+
+				goMod := filepath.Join(dst, "src", "example.org", "b", "go.mod")
+				target, err := os.Readlink(goMod)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(target).To(Equal(filepath.Join("..", "..", "..", "..", "..", "srcGopath", "example.org", "b", "go.mod")))
+				Expect(os.ReadFile(goMod)).To(Equal([]byte("module example.org/b\n")))
+
+				target, err = os.Readlink(filepath.Join(dst, "bin"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(target).To(Equal(filepath.Join("..", "..", "srcGopath", "bin")))
+			})
+		})
+
+		Describe("MapPrefixes", func() {
+			var modulesFile string
+			BeforeEach(func() {
+				Expect(makeModules(srcGopathDir, &moduleB)).NotTo(HaveOccurred())
+				modulesFile = filepath.Join(tmpDir, "modules.json")
+				Expect(os.WriteFile(modulesFile, []byte(`{"Path": "`+moduleB.Path+`", "Dir": "`+moduleB.Dir+`"}`), 0666)).To(Succeed())
+			})
+
+			It("should rewrite the link targets with the longest matching prefix", func() {
+				defer setAndRevert(&build.Default.GOPATH, "/home/user/go")()
+				Expect(Link(dstGopathDir, Options{
+					ModulesFrom: modulesFile,
+					SkipGoBin:   true,
+					MapPrefixes: []string{tmpDir + "=/workspace", srcGopathDir + "=/go/pkg/mod", "/home/user=/root"},
+				})).To(Succeed())
+
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "b", "go.mod")).To(BeASymlinkTo("/go/pkg/mod/example.org/b/go.mod"))
+				Expect(filepath.Join(dstGopathDir, "pkg")).To(BeASymlinkTo("/root/go/pkg"))
+			})
+
+			It("should compute relative links at the target location", func() {
+				Expect(Link(dstGopathDir, Options{
+					ModulesFrom:   modulesFile,
+					SkipGoBin:     true,
+					SkipGoPkg:     true,
+					RelativeLinks: true,
+					MapPrefixes:   []string{dstGopathDir + "=/workspace/gopath", srcGopathDir + "=/go/pkg/mod"},
+				})).To(Succeed())
+
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "b", "go.mod")).
+					To(BeASymlinkTo(filepath.Join("..", "..", "..", "..", "..", "go", "pkg", "mod", "example.org", "b", "go.mod")))
+			})
+
+			It("should error on invalid rules", func() {
+				Expect(Link(dstGopathDir, Options{ModulesFrom: modulesFile, MapPrefixes: []string{"relative=/go"}})).To(HaveOccurred())
+			})
+		})
+
+		Describe("Modes", func() {
+			var opts Options
+			BeforeEach(func() {
+				Expect(makeModules(srcGopathDir, &moduleA, &moduleB)).NotTo(HaveOccurred())
+				Expect(os.MkdirAll(filepath.Join(moduleA.Dir, "pkg"), 0777)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(moduleA.Dir, "pkg", "a.go"), []byte("package pkg\n"), 0444)).To(Succeed())
+
+				modulesFile := filepath.Join(tmpDir, "modules.json")
+				Expect(os.WriteFile(modulesFile, []byte(
+					`{"Path": "`+moduleA.Path+`", "Dir": "`+moduleA.Dir+`", "Main": true}`+
+						`{"Path": "`+moduleB.Path+`", "Dir": "`+moduleB.Dir+`"}`,
+				), 0666)).To(Succeed())
+				opts = Options{ModulesFrom: modulesFile, SkipGoBin: true, SkipGoPkg: true}
+			})
+
+			It("should copy the main module and symlink the dependencies", func() {
+				opts.MainMode = string(ModeCopy)
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+
+				Expect(filepath.Join(dstGopathDir, "src", "a", "pkg")).To(And(BeADirectory(), Not(BeASymlinkTo(filepath.Join(moduleA.Dir, "pkg")))))
+				copied := filepath.Join(dstGopathDir, "src", "a", "pkg", "a.go")
+				Expect(os.ReadFile(copied)).To(Equal([]byte("package pkg\n")))
+				Expect(filepath.Join(dstGopathDir, "src", "example.org", "b", "go.mod")).To(BeASymlinkTo(filepath.Join(moduleB.Dir, "go.mod")))
+
+				By("not changing anything when relinking")
+				plan, err := PlanLink(dstGopathDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(plan.Ops).To(BeEmpty())
+
+				By("copying changed files again")
+				Expect(os.Chmod(filepath.Join(moduleA.Dir, "pkg", "a.go"), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(moduleA.Dir, "pkg", "a.go"), []byte("package pkg // changed\n"), 0644)).To(Succeed())
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+				Expect(os.ReadFile(copied)).To(Equal([]byte("package pkg // changed\n")))
+			})
+
+			It("should hardlink the files of the modules matching a rule", func() {
+				opts.Mode = string(ModeReflink)
+				opts.ModuleModes = []string{"example.org/*=" + string(ModeHardlink)}
+				Expect(Link(dstGopathDir, opts)).To(Succeed())
+
+				src, err := os.Stat(filepath.Join(moduleB.Dir, "go.mod"))
+				Expect(err).NotTo(HaveOccurred())
+				dst, err := os.Lstat(filepath.Join(dstGopathDir, "src", "example.org", "b", "go.mod"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.SameFile(src, dst)).To(BeTrue())
+
+				Expect(os.ReadFile(filepath.Join(dstGopathDir, "src", "a", "pkg", "a.go"))).To(Equal([]byte("package pkg\n")))
+			})
+
+			It("should not copy the destination directory into itself", func() {
+				opts.MainMode = string(ModeCopy)
+				dstDir := filepath.Join(moduleA.Dir, ".vgopath")
+				Expect(os.Mkdir(dstDir, 0777)).To(Succeed())
+				Expect(Link(dstDir, opts)).To(Succeed())
+				Expect(Link(dstDir, opts)).To(Succeed())
+
+				Expect(filepath.Join(dstDir, "src", "a", "pkg", "a.go")).To(BeARegularFile())
+				Expect(filepath.Join(dstDir, "src", "a", ".vgopath")).NotTo(BeAnExistingFile())
+
+				plan, err := PlanLink(dstDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(plan.Ops).To(BeEmpty())
+			})
+
+			It("should copy files that cannot be hardlinked across filesystems", func() {
+				otherFS, err := os.MkdirTemp("/dev/shm", "test")
+				if err != nil {
+					Skip("no second filesystem available: " + err.Error())
+				}
+				DeferCleanup(os.RemoveAll, otherFS)
+				if err := os.Link(filepath.Join(moduleB.Dir, "go.mod"), filepath.Join(otherFS, "probe")); err == nil {
+					Skip("/dev/shm is on the same filesystem as " + tmpDir)
+				}
+
+				opts.Mode = string(ModeHardlink)
+				dstDir := filepath.Join(otherFS, "gopath")
+				Expect(os.Mkdir(dstDir, 0777)).To(Succeed())
+				Expect(Link(dstDir, opts)).To(Succeed())
+				Expect(os.ReadFile(filepath.Join(dstDir, "src", "a", "pkg", "a.go"))).To(Equal([]byte("package pkg\n")))
+
+				By("not copying the files again when relinking")
+				plan, err := PlanLink(dstDir, opts)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(plan.Ops).To(BeEmpty())
+			})
+
+			It("should error on invalid modes", func() {
+				opts.ModuleModes = []string{"example.org/*=move"}
+				Expect(Link(dstGopathDir, opts)).To(MatchError(ContainSubstring(`invalid mode "move"`)))
+			})
 		})
 
 		Describe("GoBin", func() {
@@ -193,6 +1165,23 @@ var _ = Describe("Internal", func() {
 				Expect(dstGoBinDir).To(BeASymlinkTo(srcGoBinDir))
 			})
 
+			It("should replace an existing go bin directory", func() {
+				defer setEnvAndRevert("GOBIN", srcGoBinDir)()
+				Expect(os.WriteFile(filepath.Join(dstGopathDir, MarkerFile), nil, 0666)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(dstGoBinDir, "tool"), 0777)).To(Succeed())
+
+				Expect(GoBin(dstGopathDir)).To(Succeed())
+				Expect(dstGoBinDir).To(BeASymlinkTo(srcGoBinDir))
+			})
+
+			It("should refuse to replace the go bin directory of a directory not created by vgopath", func() {
+				defer setEnvAndRevert("GOBIN", srcGoBinDir)()
+				Expect(os.MkdirAll(filepath.Join(dstGoBinDir, "tool"), 0777)).To(Succeed())
+
+				Expect(GoBin(dstGopathDir)).To(MatchError(ContainSubstring("not created by vgopath")))
+				Expect(filepath.Join(dstGoBinDir, "tool")).To(BeADirectory())
+			})
+
 			It("should correctly link go bin if GOBIN is set", func() {
 				defer setEnvAndRevert("GOBIN", srcGoBinDir)()
 
@@ -240,6 +1229,42 @@ func makeModules(gopath string, mods ...*module.Module) error {
 	return nil
 }
 
+// snapshotDir returns the mode and content of every entry below dir, keyed by the path relative to dir.
+func snapshotDir(dir string) map[string]string {
+	snapshot := make(map[string]string)
+	Expect(filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var content []byte
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			content = []byte(target)
+		case d.Type().IsRegular():
+			if content, err = os.ReadFile(path); err != nil {
+				return err
+			}
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		snapshot[rel] = info.Mode().String() + " " + string(content)
+		return nil
+	})).To(Succeed())
+	return snapshot
+}
+
 func HaveEntries(expected map[string]types.GomegaMatcher) types.GomegaMatcher {
 	return &haveEntriesMatcher{matchers: expected}
 }
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// LockFile is the name of the file inside the destination directory that is locked by vgopath.
+// It is never removed, as removing a lock file races with processes waiting for it.
+const LockFile = ".vgopath.lock"
+
+// Lock is an advisory lock on a destination directory.
+type Lock struct {
+	f *os.File
+}
+
+// LockExclusive waits for and takes the exclusive lock on dstDir, as held while linking.
+func LockExclusive(dstDir string) (*Lock, error) {
+	return lock(dstDir, true)
+}
+
+// LockShared waits for and takes a shared lock on dstDir, which keeps it from being linked
+// while the lock is held.
+func LockShared(dstDir string) (*Lock, error) {
+	return lock(dstDir, false)
+}
+
+func lock(dstDir string, exclusive bool) (*Lock, error) {
+	path := filepath.Join(dstDir, LockFile)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %w", err)
+	}
+
+	if err := flock(f, exclusive); err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			warnLockUnsupported.Do(func() {
+				log.Printf("Warning: %v, concurrent runs are not synchronized", err)
+			})
+			return &Lock{f: f}, nil
+		}
+		_ = f.Close()
+		return nil, fmt.Errorf("error locking %s: %w", path, err)
+	}
+	return &Lock{f: f}, nil
+}
+
+// warnLockUnsupported warns once that the platform has no advisory locks.
+var warnLockUnsupported sync.Once
+
+// locked calls f while holding the lock on dstDir.
+func locked(dstDir string, exclusive bool, f func() error) error {
+	l, err := lock(dstDir, exclusive)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = l.Unlock() }()
+
+	return f()
+}
+
+// lockOwned takes the exclusive lock on dstDir to link it for opts. It refuses a directory vgopath does
+// not take over before creating the lock file in it, so a refused run leaves the directory untouched.
+// The check is repeated while the lock is held.
+func lockOwned(dstDir string, opts Options) (*Lock, error) {
+	if _, err := checkOwner(dstDir, opts); err != nil {
+		return nil, err
+	}
+	return lock(dstDir, true)
+}
+
+// lockedOwned calls f while holding the exclusive lock on dstDir taken by lockOwned.
+func lockedOwned(dstDir string, opts Options, f func() error) error {
+	l, err := lockOwned(dstDir, opts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = l.Unlock() }()
+
+	return f()
+}
+
+// Shared converts the lock into a shared lock. The conversion is not atomic, another process
+// waiting for the exclusive lock may take it before the shared lock is in place.
+func (l *Lock) Shared() error {
+	return flock(l.f, false)
+}
+
+// Unlock releases the lock.
+func (l *Lock) Unlock() error {
+	return l.f.Close()
+}
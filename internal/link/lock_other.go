@@ -0,0 +1,18 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+
+package link
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// flock is not supported on this platform. The caller warns that concurrent runs are not synchronized.
+func flock(_ *os.File, _ bool) error {
+	return fmt.Errorf("locking is not supported on %s: %w", runtime.GOOS, errors.ErrUnsupported)
+}
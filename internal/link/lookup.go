@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link
+
+import (
+	"iter"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ironcore-dev/vgopath/internal/module"
+)
+
+// LookupImportPath returns the module providing the package with the given import path, i.e. the
+// module with the longest path that is a prefix of it, and the directory of the package relative
+// to the module directory. The nodes have to be sorted by segment, as returned by BuildModuleNodes.
+func LookupImportPath(nodes []Node, importPath string) (*module.Module, string, bool) {
+	var (
+		mod   *module.Module
+		depth int
+	)
+	segments := strings.Split(importPath, "/")
+	for i, segment := range segments {
+		idx, ok := slices.BinarySearchFunc(nodes, segment, func(node Node, segment string) int {
+			return strings.Compare(node.Segment, segment)
+		})
+		if !ok {
+			break
+		}
+
+		node := nodes[idx]
+		if node.Module != nil {
+			mod, depth = node.Module, i+1
+		}
+		nodes = node.Children
+	}
+	if mod == nil {
+		return nil, "", false
+	}
+	return mod, filepath.Join(segments[depth:]...), true
+}
+
+// ImportPathForDir returns the import path of the package in the directory dir. It reports false
+// if dir is not inside a module directory or if the package is shadowed by a nested module.
+func ImportPathForDir(nodes []Node, dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+
+	var (
+		mod    *module.Module
+		modDir string
+		rest   string
+	)
+	for _, node := range Walk(nodes) {
+		if node.Module == nil || node.Module.Dir == "" {
+			continue
+		}
+
+		candidateDir, err := filepath.Abs(node.Module.Dir)
+		if err != nil {
+			continue
+		}
+		// The module with the deepest directory containing dir wins.
+		if candidateRest, ok := cutPathPrefix(dir, candidateDir); ok && (mod == nil || len(candidateDir) > len(modDir)) {
+			mod, modDir, rest = node.Module, candidateDir, candidateRest
+		}
+	}
+	if mod == nil {
+		return "", false
+	}
+
+	importPath := path.Join(mod.Path, filepath.ToSlash(rest))
+	if provider, _, ok := LookupImportPath(nodes, importPath); !ok || provider != mod {
+		return "", false
+	}
+	return importPath, true
+}
+
+// Walk returns an iterator over the import paths and nodes of the tree. Parents are yielded
+// before their children, in the order of the nodes.
+func Walk(nodes []Node) iter.Seq2[string, Node] {
+	return func(yield func(string, Node) bool) {
+		walk(nodes, "", yield)
+	}
+}
+
+func walk(nodes []Node, parent string, yield func(string, Node) bool) bool {
+	for _, node := range nodes {
+		importPath := path.Join(parent, node.Segment)
+		if !yield(importPath, node) || !walk(node.Children, importPath, yield) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/ironcore-dev/vgopath/internal/cache"
+	"github.com/ironcore-dev/vgopath/internal/module"
+	"github.com/ironcore-dev/vgopath/internal/version"
+)
+
+// ManifestFile is the name of the manifest inside the destination directory.
+const ManifestFile = ".vgopath-manifest.json"
+
+// manifestVersion is the version of the manifest format.
+const manifestVersion = 1
+
+// Manifest describes the entries Link created in a destination directory.
+type Manifest struct {
+	Version        int
+	VgopathVersion string
+	// SrcDir is the absolute source directory the modules were resolved from.
+	SrcDir string
+	// InputsHash is a hash of the go.mod, go.sum and go.work files and the options used to resolve the modules.
+	// It is empty if the files could not be read.
+	InputsHash string `json:",omitempty"`
+	// Merged is set if the modules were merged into an existing GOPATH. Then, only the entries
+	// of the modules belong to vgopath.
+	Merged  bool `json:",omitempty"`
+	Modules []ManifestModule
+	// Links are the paths of the GOPATH/bin and GOPATH/pkg symlinks belonging to vgopath, relative
+	// to the destination directory.
+	Links []string `json:",omitempty"`
+}
+
+// ManifestModule describes the entries created for a module.
+type ManifestModule struct {
+	Path    string
+	Version string `json:",omitempty"`
+	Dir     string
+	Mode    Mode
+	// Entries are the paths of the entries created for the module, relative to the destination directory.
+	Entries []string
+}
+
+// ReadManifest reads the manifest of the destination directory. It returns nil if there is none.
+func ReadManifest(dstDir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dstDir, ManifestFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("error decoding manifest: %w", err)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+	return manifest, nil
+}
+
+func writeManifest(dstDir string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dstDir, ManifestFile)
+	return replaceFile(path, func(tmpPath string) error {
+		return os.WriteFile(tmpPath, append(data, '\n'), 0666)
+	})
+}
+
+func newManifest(opts Options, workFile string, goCmd *module.GoCommandOptions) (*Manifest, error) {
+	srcDir, err := filepath.Abs(opts.SrcDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like the go list cache, the hash is best-effort.
+	inputsHash, _ := cache.Key(cache.Inputs{
+		Dir:      opts.SrcDir,
+		WorkFile: workFile,
+		ModFile:  goCmd.ModFile,
+		Values: append([]string{
+			"modules-from=" + opts.ModulesFrom,
+			fmt.Sprintf("offline=%t", opts.Offline),
+			"vendor=" + opts.Vendor,
+			fmt.Sprintf("download=%t", opts.Download),
+		}, goCommandValues(goCmd)...),
+	})
+
+	return &Manifest{
+		Version:        manifestVersion,
+		VgopathVersion: version.Version(),
+		SrcDir:         srcDir,
+		InputsHash:     inputsHash,
+		Merged:         opts.Merge,
+		Modules:        []ManifestModule{},
+	}, nil
+}
+
+// skippedSrcManifest returns the manifest of a run that leaves GOPATH/src alone. The modules and the
+// inputs they were resolved from are kept from the previous manifest, as they still describe GOPATH/src.
+func skippedSrcManifest(dstDir string, opts Options) (*Manifest, error) {
+	manifest := &Manifest{
+		Version:        manifestVersion,
+		VgopathVersion: version.Version(),
+		Merged:         opts.Merge,
+		Modules:        []ManifestModule{},
+	}
+
+	previous, err := ReadManifest(dstDir)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		manifest.SrcDir = previous.SrcDir
+		manifest.InputsHash = previous.InputsHash
+		// Entries of GOPATH/src not created by vgopath are still there.
+		manifest.Merged = manifest.Merged || previous.Merged
+		manifest.Modules = previous.Modules
+	}
+	return manifest, nil
+}
@@ -0,0 +1,277 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/ironcore-dev/vgopath/internal/module"
+)
+
+// MarkerFile marks a destination directory as created by vgopath.
+const MarkerFile = ".vgopath"
+
+const markerContent = "This directory is a virtual GOPATH managed by vgopath. Its contents may be removed at any time.\n"
+
+// IsMarked reports whether dstDir is marked as created by vgopath.
+func IsMarked(dstDir string) (bool, error) {
+	if _, err := os.Lstat(filepath.Join(dstDir, MarkerFile)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// own marks the destination directory as created by vgopath. It refuses to take over a non-empty
+// directory without marker unless forced or merging, so a real GOPATH is never pruned by accident.
+// For the same reason, a directory merged into is only linked again in merge mode unless forced.
+// Trees created by vgopath versions before the marker are adopted.
+func (r *reconciler) own(opts Options) error {
+	marked, err := checkOwner(r.root, opts)
+	if err != nil || marked {
+		return err
+	}
+
+	r.add(OpMark, MarkerFile, "")
+	return nil
+}
+
+// checkOwner returns an error if own refuses to take over dstDir. It reports whether dstDir is marked.
+func checkOwner(dstDir string, opts Options) (bool, error) {
+	marked, err := IsMarked(dstDir)
+	if err != nil {
+		return false, err
+	}
+
+	if marked {
+		if opts.Merge || opts.Force {
+			return true, nil
+		}
+		manifest, err := ReadManifest(dstDir)
+		if err != nil {
+			return false, err
+		}
+		if manifest != nil && manifest.Merged {
+			return false, fmt.Errorf("refusing to modify %s: modules were merged into it, use --merge to link again or --force to replace it", dstDir)
+		}
+		return true, nil
+	}
+
+	if !opts.Force && !opts.Merge {
+		reason, err := foreignReason(dstDir, opts)
+		if err != nil {
+			return false, err
+		}
+		if reason != "" {
+			return false, fmt.Errorf("refusing to modify %s: it was not created by vgopath (%s), use --force to link anyway", dstDir, reason)
+		}
+	}
+	return false, nil
+}
+
+// errForeign ends the walk of GOPATH/src once an entry not created by vgopath is found.
+var errForeign = errors.New("foreign entry")
+
+// foreignReason returns why the unmarked directory dstDir is not taken over, or an empty string if
+// it is empty or looks like a tree created by a vgopath version before the marker. Such a tree only
+// contains GOPATH/bin and GOPATH/pkg as symlinks and GOPATH/src with directories and symlinks into
+// the module cache or the project.
+func foreignReason(dstDir string, opts Options) (string, error) {
+	entries, err := os.ReadDir(dstDir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, entry := range entries {
+		switch name := entry.Name(); name {
+		case LockFile:
+		case "bin", "pkg":
+			if entry.Type()&fs.ModeSymlink == 0 {
+				return fmt.Sprintf("%s is not a symlink", name), nil
+			}
+		case "src":
+			if !entry.IsDir() {
+				return "src is not a directory", nil
+			}
+			reason, err := foreignSrcReason(dstDir, opts)
+			if err != nil || reason != "" {
+				return reason, err
+			}
+		default:
+			return fmt.Sprintf("it contains %s", name), nil
+		}
+	}
+	return "", nil
+}
+
+func foreignSrcReason(dstDir string, opts Options) (string, error) {
+	roots, err := legacyTargetRoots(opts)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		reason string
+		links  int
+	)
+	err = filepath.WalkDir(filepath.Join(dstDir, "src"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dstDir, path)
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			reason = fmt.Sprintf("%s is not a symlink", rel)
+			return errForeign
+		}
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		if !slices.ContainsFunc(roots, func(root string) bool {
+			_, ok := cutPathPrefix(filepath.Clean(target), root)
+			return ok
+		}) {
+			reason = fmt.Sprintf("%s points outside of the module cache and the project", rel)
+			return errForeign
+		}
+		links++
+		return nil
+	})
+	switch {
+	case errors.Is(err, errForeign):
+		return reason, nil
+	case err != nil:
+		return "", err
+	case links == 0:
+		// vgopath links at least the main module, so an empty GOPATH/src tree is not its own.
+		return "src contains no links", nil
+	default:
+		return "", nil
+	}
+}
+
+// legacyTargetRoots returns the absolute directories vgopath links GOPATH/src into: the module cache,
+// the source directory and the workspace directory, if any.
+func legacyTargetRoots(opts Options) ([]string, error) {
+	var roots []string
+	if modCache := module.DefaultModCache(); modCache != "" {
+		roots = append(roots, modCache)
+	}
+	roots = append(roots, opts.SrcDir)
+
+	workFile, err := workFile(opts)
+	if err != nil {
+		return nil, err
+	}
+	if workFile != "" && workFile != module.GoWorkOff {
+		roots = append(roots, filepath.Dir(workFile))
+	}
+
+	for i, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		roots[i] = abs
+	}
+	return roots, nil
+}
+
+// Clean removes the entries created by vgopath from dstDir: GOPATH/src, GOPATH/bin, GOPATH/pkg,
+// the manifest and the marker. Other entries and the lock file are kept. If modules were merged into dstDir, only
+// their entries are removed from GOPATH/src. It refuses to clean a directory without marker
+// unless force is set.
+func Clean(dstDir string, force bool) error {
+	// Check before locking, so no lock file is created in a directory that is not cleaned.
+	if err := checkClean(dstDir, force); err != nil {
+		return err
+	}
+	return locked(dstDir, true, func() error {
+		return clean(dstDir, force)
+	})
+}
+
+// checkClean returns an error if dstDir is not cleaned.
+func checkClean(dstDir string, force bool) error {
+	marked, err := IsMarked(dstDir)
+	if err != nil {
+		return err
+	}
+	if !marked && !force {
+		return fmt.Errorf("refusing to clean %s: it was not created by vgopath, use --force to clean anyway", dstDir)
+	}
+	return nil
+}
+
+func clean(dstDir string, force bool) error {
+	if err := checkClean(dstDir, force); err != nil {
+		return err
+	}
+
+	names := []string{"src", "bin", "pkg"}
+	manifest, err := ReadManifest(dstDir)
+	if err != nil && !force {
+		return err
+	}
+	if manifest != nil && manifest.Merged {
+		if err := cleanMerged(dstDir, manifest); err != nil {
+			return err
+		}
+		names = nil
+	}
+
+	// The marker goes last, so an interrupted clean can be repeated.
+	for _, name := range append(names, ManifestFile, MarkerFile) {
+		path := filepath.Join(dstDir, name)
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("error removing %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// cleanMerged removes the entries of the merged modules and the directories left empty by that.
+// The GOPATH/bin and GOPATH/pkg symlinks are only removed if they belong to vgopath.
+func cleanMerged(dstDir string, manifest *Manifest) error {
+	for _, mod := range manifest.Modules {
+		for _, entry := range mod.Entries {
+			path := filepath.Join(dstDir, entry)
+			if err := os.RemoveAll(path); err != nil {
+				return fmt.Errorf("error removing %s: %w", path, err)
+			}
+
+			// Removing a non-empty directory fails, which ends the cleanup of the parents.
+			for dir := filepath.Dir(entry); dir != "." && dir != "src"; dir = filepath.Dir(dir) {
+				if os.Remove(filepath.Join(dstDir, dir)) != nil {
+					break
+				}
+			}
+		}
+	}
+
+	for _, link := range manifest.Links {
+		path := filepath.Join(dstDir, link)
+		if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("error removing %s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
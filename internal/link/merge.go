@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Conflict is the policy for entries in merge mode that collide with entries not created by vgopath.
+type Conflict string
+
+const (
+	// ConflictFail fails linking.
+	ConflictFail Conflict = "fail"
+	// ConflictSkip keeps the existing entry and does not link the colliding one.
+	ConflictSkip Conflict = "skip"
+	// ConflictOverride replaces the existing entry.
+	ConflictOverride Conflict = "override"
+)
+
+func parseConflict(s string) (Conflict, error) {
+	switch conflict := Conflict(s); conflict {
+	case "":
+		return ConflictFail, nil
+	case ConflictFail, ConflictSkip, ConflictOverride:
+		return conflict, nil
+	default:
+		return "", fmt.Errorf("invalid conflict policy %q, must be one of %s, %s, %s", s, ConflictFail, ConflictSkip, ConflictOverride)
+	}
+}
+
+// errSkip is returned when an entry is skipped because of ConflictSkip.
+var errSkip = errors.New("skipped conflicting entry")
+
+// merger knows which entries of the destination directory were created by vgopath in merge mode.
+type merger struct {
+	conflict Conflict
+	// owned are the paths of the entries created by the previous run, from its manifest.
+	owned map[string]struct{}
+}
+
+func newMerger(root string, opts Options) (*merger, error) {
+	if !opts.Merge {
+		return nil, nil
+	}
+
+	conflict, err := parseConflict(opts.Conflict)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := ReadManifest(root)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make(map[string]struct{})
+	if manifest != nil {
+		for _, mod := range manifest.Modules {
+			for _, entry := range mod.Entries {
+				owned[entry] = struct{}{}
+			}
+		}
+		for _, link := range manifest.Links {
+			owned[link] = struct{}{}
+		}
+	}
+	return &merger{conflict: conflict, owned: owned}, nil
+}
+
+// owns reports whether path or one of its parents was created by vgopath. Without merge mode,
+// vgopath owns every entry.
+func (m *merger) owns(path string) bool {
+	if m == nil {
+		return true
+	}
+	for {
+		if _, ok := m.owned[path]; ok {
+			return true
+		}
+		parent := filepath.Dir(path)
+		if parent == path || parent == "." {
+			return false
+		}
+		path = parent
+	}
+}
+
+// ownedBelow returns the sorted paths of the entries created by vgopath below the directory at path.
+func (m *merger) ownedBelow(path string) []string {
+	if m == nil {
+		return nil
+	}
+
+	var res []string
+	prefix := path + string(filepath.Separator)
+	for owned := range m.owned {
+		if strings.HasPrefix(owned, prefix) {
+			res = append(res, owned)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// replace is called before replacing or removing the existing entry at path. It applies the
+// conflict policy if the entry was not created by vgopath and returns errSkip if it is to be kept.
+func (r *reconciler) replace(path string) error {
+	if r.merge.owns(path) {
+		return nil
+	}
+
+	switch r.merge.conflict {
+	case ConflictOverride:
+		return nil
+	case ConflictSkip:
+		return errSkip
+	default:
+		return fmt.Errorf("%s exists and was not created by vgopath, use --conflict to skip or override it", path)
+	}
+}
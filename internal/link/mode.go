@@ -0,0 +1,316 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/ironcore-dev/vgopath/internal/module"
+)
+
+// Mode is the way the entries of a module are materialized in the destination directory.
+type Mode string
+
+const (
+	// ModeSymlink symlinks every entry of the module.
+	ModeSymlink Mode = "symlink"
+	// ModeHardlink recreates the directories of the module and hardlinks its files.
+	ModeHardlink Mode = "hardlink"
+	// ModeCopy recreates the directories of the module and copies its files.
+	ModeCopy Mode = "copy"
+	// ModeReflink is like ModeCopy but clones the files if the filesystem supports it.
+	ModeReflink Mode = "reflink"
+)
+
+func parseMode(s string) (Mode, error) {
+	switch mode := Mode(s); mode {
+	case "":
+		return ModeSymlink, nil
+	case ModeSymlink, ModeHardlink, ModeCopy, ModeReflink:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid mode %q, must be one of %s, %s, %s, %s", s, ModeSymlink, ModeHardlink, ModeCopy, ModeReflink)
+	}
+}
+
+type modeRule struct {
+	pattern string
+	mode    Mode
+}
+
+// modeSelector determines the mode of a module.
+type modeSelector struct {
+	// rules are matched against the module path in order, the first match wins.
+	rules    []modeRule
+	mainMode Mode
+	mode     Mode
+}
+
+func newModeSelector(opts Options) (*modeSelector, error) {
+	mode, err := parseMode(opts.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	mainMode := mode
+	if opts.MainMode != "" {
+		if mainMode, err = parseMode(opts.MainMode); err != nil {
+			return nil, fmt.Errorf("invalid main mode: %w", err)
+		}
+	}
+
+	rules := make([]modeRule, 0, len(opts.ModuleModes))
+	for _, rule := range opts.ModuleModes {
+		pattern, s, ok := strings.Cut(rule, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid module mode %q, must be <pattern>=<mode>", rule)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid module mode pattern %q: %w", pattern, err)
+		}
+		mode, err := parseMode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid module mode %q: %w", rule, err)
+		}
+		rules = append(rules, modeRule{pattern: pattern, mode: mode})
+	}
+
+	return &modeSelector{rules: rules, mainMode: mainMode, mode: mode}, nil
+}
+
+func (s *modeSelector) modeFor(mod *module.Module) Mode {
+	if s == nil {
+		return ModeSymlink
+	}
+	for _, rule := range s.rules {
+		if ok, _ := path.Match(rule.pattern, mod.Path); ok {
+			return rule.mode
+		}
+	}
+	if mod.Main {
+		return s.mainMode
+	}
+	return s.mode
+}
+
+// fileOpKind returns the operation materializing a file in the given mode.
+func fileOpKind(mode Mode) OpKind {
+	switch mode {
+	case ModeHardlink:
+		return OpHardlink
+	case ModeReflink:
+		return OpReflink
+	default:
+		return OpCopy
+	}
+}
+
+// fileUpToDate reports whether dst is the result of materializing src with the given operation.
+// Copies are compared by size, modification time and permissions, as those are preserved.
+func fileUpToDate(kind OpKind, dst, src fs.FileInfo) bool {
+	if !dst.Mode().IsRegular() {
+		return false
+	}
+	if kind == OpHardlink && os.SameFile(dst, src) {
+		return true
+	}
+	// Hardlinks falling back to a copy are compared like copies.
+	return dst.Size() == src.Size() && dst.ModTime().Equal(src.ModTime()) && dst.Mode() == src.Mode()
+}
+
+// replaceFile materializes the file src at dst using create on a temporary file next to dst
+// that is then renamed to dst, so an existing dst is replaced atomically.
+func replaceFile(dst string, create func(tmpPath string) error) error {
+	tmpPath := dst + ".vgopath-tmp"
+	if err := os.Remove(tmpPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := create(tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// hardlinkFile hardlinks src to dst. Hardlinks cannot cross filesystems, e.g. if the module cache
+// is on another mount, so src is copied then.
+func hardlinkFile(src, dst string) error {
+	return replaceFile(dst, func(tmpPath string) error {
+		if err := os.Link(src, tmpPath); !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+		return writeFileCopy(src, tmpPath, false)
+	})
+}
+
+func copyFile(src, dst string) error {
+	return replaceFile(dst, func(tmpPath string) error {
+		return writeFileCopy(src, tmpPath, false)
+	})
+}
+
+// reflinkFile clones src to dst if supported by the filesystem and copies it otherwise.
+func reflinkFile(src, dst string) error {
+	return replaceFile(dst, func(tmpPath string) error {
+		return writeFileCopy(src, tmpPath, true)
+	})
+}
+
+func writeFileCopy(src, dst string, reflink bool) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if !reflink || cloneFile(out, in) != nil {
+		if _, err := io.Copy(out, in); err != nil {
+			_ = out.Close()
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// Preserve the permissions and modification time, they are used to detect changes.
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// materialize ensures path is the materialized version of the entry at src.
+// If exists is false, the parent directory is known to be new and the entry is not checked.
+func (r *reconciler) materialize(path, src string, mode Mode, exists bool) error {
+	if mode == ModeSymlink {
+		return r.link(path, src, exists)
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return r.symlink(path, target, exists)
+	case info.IsDir():
+		return r.materializeDir(path, src, mode, exists)
+	case info.Mode().IsRegular():
+		return r.file(path, src, info, fileOpKind(mode), exists)
+	default:
+		// Sockets, devices and the like are not part of modules.
+		return nil
+	}
+}
+
+func (r *reconciler) materializeDir(path, src string, mode Mode, parentExists bool) error {
+	exists := false
+	if parentExists {
+		var err error
+		if exists, err = r.dir(path); err != nil {
+			return err
+		}
+	} else {
+		r.add(OpMkdir, path, "")
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if entries, err = r.withoutRoot(src, entries); err != nil {
+		return err
+	}
+
+	if exists {
+		keep := make(map[string]struct{}, len(entries))
+		for _, entry := range entries {
+			keep[entry.Name()] = struct{}{}
+		}
+		if err := r.prune(path, keep); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		if err := r.materialize(filepath.Join(path, entry.Name()), filepath.Join(src, entry.Name()), mode, exists); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withoutRoot drops the destination directory from the entries of the directory src. Otherwise,
+// a module containing it, like the main module with the destination inside the project, would be
+// copied into itself and grow with every run.
+func (r *reconciler) withoutRoot(src string, entries []fs.DirEntry) ([]fs.DirEntry, error) {
+	rootInfo, err := os.Stat(r.root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return entries, nil
+		}
+		return nil, err
+	}
+
+	return slices.DeleteFunc(entries, func(entry fs.DirEntry) bool {
+		if !entry.IsDir() {
+			return false
+		}
+		info, err := os.Stat(filepath.Join(src, entry.Name()))
+		return err == nil && os.SameFile(info, rootInfo)
+	}), nil
+}
+
+// file ensures path is the result of materializing the regular file src with the given operation.
+func (r *reconciler) file(path, src string, srcInfo fs.FileInfo, kind OpKind, exists bool) error {
+	if exists {
+		info, err := r.lstat(path)
+		if err != nil {
+			return err
+		}
+
+		if info != nil {
+			if fileUpToDate(kind, info, srcInfo) {
+				return nil
+			}
+			if err := r.replace(path); err != nil {
+				return err
+			}
+			if info.IsDir() {
+				r.add(OpRemove, path, "")
+			}
+		}
+	}
+	r.add(kind, path, src)
+	return nil
+}
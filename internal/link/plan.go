@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type OpKind string
+
+const (
+	OpMkdir   OpKind = "mkdir"
+	OpSymlink OpKind = "symlink"
+	OpRemove  OpKind = "remove"
+	OpMark    OpKind = "mark"
+	OpSwap    OpKind = "swap"
+
+	OpHardlink OpKind = "hardlink"
+	OpCopy     OpKind = "copy"
+	OpReflink  OpKind = "reflink"
+)
+
+// Op is a single change to the destination directory.
+type Op struct {
+	Kind OpKind
+	// Source depends on the kind:
+	//   - symlink: the link target as written to the symlink. It is absolute, relative to the directory
+	//     containing the symlink with --relative-links, and rewritten by --map-prefix rules.
+	//   - hardlink, copy, reflink: the absolute path of the file to materialize.
+	//   - swap: the staging directory to swap in, relative to the destination directory.
+	// It is empty for other kinds.
+	Source string `json:",omitempty"`
+	// Destination is the path of the changed entry, relative to the destination directory.
+	Destination string
+}
+
+func (o Op) String() string {
+	switch o.Kind {
+	case OpSymlink:
+		return fmt.Sprintf("%s %s -> %s", o.Kind, o.Destination, o.Source)
+	case OpHardlink, OpCopy, OpReflink, OpSwap:
+		return fmt.Sprintf("%s %s from %s", o.Kind, o.Destination, o.Source)
+	default:
+		return fmt.Sprintf("%s %s", o.Kind, o.Destination)
+	}
+}
+
+// Plan lists the changes to bring a destination directory into the desired state.
+// The operations have to be applied in order.
+type Plan struct {
+	DstDir string
+	Ops    []Op
+	// Manifest is written to the destination directory once the operations are applied.
+	Manifest *Manifest `json:",omitempty"`
+	// Staging is the directory, relative to the destination directory, a tree is built in before
+	// it is swapped in. It is removed if applying the plan fails.
+	Staging string `json:",omitempty"`
+}
+
+// Apply executes the operations of the plan, using GOMAXPROCS workers.
+func Apply(plan *Plan) error {
+	return apply(plan, newJobs(0))
+}
+
+// apply executes the operations of the plan. If it fails, the staging directory is removed.
+func apply(plan *Plan, j jobs) error {
+	if err := applyOps(plan.DstDir, plan.Ops, j); err != nil {
+		if plan.Staging != "" {
+			_ = os.RemoveAll(filepath.Join(plan.DstDir, plan.Staging))
+		}
+		return err
+	}
+
+	if plan.Manifest != nil {
+		if err := writeManifest(plan.DstDir, plan.Manifest); err != nil {
+			return fmt.Errorf("error writing manifest: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyOps executes the operations concurrently. Operations only depend on earlier operations
+// on the same path or on a parent path, so they are applied level by level and the operations on
+// different paths of a level run concurrently. Swaps depend on all earlier operations and are
+// applied on their own.
+func applyOps(dstDir string, ops []Op, j jobs) error {
+	for len(ops) > 0 {
+		n := slices.IndexFunc(ops, func(op Op) bool { return op.Kind == OpSwap })
+		if n == -1 {
+			n = len(ops)
+		}
+
+		for _, level := range planLevels(ops[:n]) {
+			if err := j.run(len(level), func(i int) error {
+				for _, op := range level[i] {
+					if err := applyOp(dstDir, op); err != nil {
+						return err
+					}
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		if n < len(ops) {
+			if err := applyOp(dstDir, ops[n]); err != nil {
+				return err
+			}
+			n++
+		}
+		ops = ops[n:]
+	}
+	return nil
+}
+
+// planLevels groups the operations by the depth of their destination and, within a level,
+// by their destination. The order of the operations is kept within each group.
+func planLevels(ops []Op) [][][]Op {
+	var (
+		levels   [][][]Op
+		idxByDst = make(map[string]int)
+	)
+	for _, op := range ops {
+		dst := filepath.Clean(op.Destination)
+		depth := strings.Count(dst, string(filepath.Separator))
+		for len(levels) <= depth {
+			levels = append(levels, nil)
+		}
+
+		idx, ok := idxByDst[dst]
+		if !ok {
+			idx = len(levels[depth])
+			idxByDst[dst] = idx
+			levels[depth] = append(levels[depth], nil)
+		}
+		levels[depth][idx] = append(levels[depth][idx], op)
+	}
+	return levels
+}
+
+func applyOp(dstDir string, op Op) error {
+	path := filepath.Join(dstDir, op.Destination)
+	switch op.Kind {
+	case OpMkdir:
+		if err := os.Mkdir(path, 0777); err != nil {
+			return fmt.Errorf("error creating directory %s: %w", path, err)
+		}
+	case OpRemove:
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("error removing %s: %w", path, err)
+		}
+	case OpSwap:
+		staging := filepath.Join(dstDir, op.Source)
+		if err := swapDir(staging, path); err != nil {
+			return fmt.Errorf("error swapping %s into %s: %w", staging, path, err)
+		}
+	case OpMark:
+		if err := os.WriteFile(path, []byte(markerContent), 0666); err != nil {
+			return fmt.Errorf("error marking %s: %w", dstDir, err)
+		}
+	case OpSymlink:
+		if err := replaceSymlink(op.Source, path); err != nil {
+			return fmt.Errorf("error symlinking %s to %s: %w", op.Source, path, err)
+		}
+	case OpHardlink:
+		if err := hardlinkFile(op.Source, path); err != nil {
+			return fmt.Errorf("error hardlinking %s to %s: %w", op.Source, path, err)
+		}
+	case OpCopy:
+		if err := copyFile(op.Source, path); err != nil {
+			return fmt.Errorf("error copying %s to %s: %w", op.Source, path, err)
+		}
+	case OpReflink:
+		if err := reflinkFile(op.Source, path); err != nil {
+			return fmt.Errorf("error reflinking %s to %s: %w", op.Source, path, err)
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", op.Kind)
+	}
+	return nil
+}
+
+// replaceSymlink creates a symlink to target at path. An existing symlink or file at path is replaced
+// atomically, so the path never disappears for concurrent readers.
+func replaceSymlink(target, path string) error {
+	err := os.Symlink(target, path)
+	if !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	tmpPath := path + ".vgopath-tmp"
+	if err := os.Remove(tmpPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Symlink(target, tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// reconciler diffs the desired tree against the tree at root and records the changes
+// needed to get from one to the other.
+type reconciler struct {
+	root    string
+	modes   *modeSelector
+	targets *linkTargets
+	merge   *merger
+	jobs    jobs
+	ops     []Op
+	// staging is the directory a tree is built in before it is swapped in.
+	staging string
+	// modules describes the entries created for each module, in the order of the operations.
+	modules []ManifestModule
+	// links are the entries outside of GOPATH/src that belong to vgopath.
+	links []string
+}
+
+func newReconciler(root string, opts Options) (*reconciler, error) {
+	modes, err := newModeSelector(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := newLinkTargets(root, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	merge, err := newMerger(root, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &reconciler{root: root, modes: modes, targets: targets, merge: merge, jobs: newJobs(opts.Jobs)}, nil
+}
+
+// fork returns a reconciler for the same tree recording its changes separately.
+func (r *reconciler) fork() *reconciler {
+	return &reconciler{root: r.root, modes: r.modes, targets: r.targets, merge: r.merge, jobs: r.jobs}
+}
+
+func (r *reconciler) add(kind OpKind, path, target string) {
+	r.ops = append(r.ops, Op{Kind: kind, Source: target, Destination: path})
+}
+
+// lstat returns the file info of the entry at path. It returns nil if there is no entry.
+func (r *reconciler) lstat(path string) (fs.FileInfo, error) {
+	info, err := os.Lstat(filepath.Join(r.root, path))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
+// dir ensures path is a directory. It reports whether the directory is already present.
+func (r *reconciler) dir(path string) (bool, error) {
+	info, err := r.lstat(path)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case info == nil:
+	case info.IsDir():
+		return true, nil
+	default:
+		if err := r.replace(path); err != nil {
+			return false, err
+		}
+		r.add(OpRemove, path, "")
+	}
+	r.add(OpMkdir, path, "")
+	return false, nil
+}
+
+// symlink ensures path is a symlink to target. If exists is false, the parent directory
+// is known to be new and the entry is not checked.
+func (r *reconciler) symlink(path, target string, exists bool) error {
+	if !exists {
+		r.add(OpSymlink, path, target)
+		return nil
+	}
+
+	info, err := r.lstat(path)
+	if err != nil {
+		return err
+	}
+
+	if info != nil {
+		if info.Mode()&fs.ModeSymlink != 0 {
+			current, err := os.Readlink(filepath.Join(r.root, path))
+			if err != nil {
+				return err
+			}
+			if current == target {
+				return nil
+			}
+		}
+
+		if err := r.replace(path); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			r.add(OpRemove, path, "")
+		}
+	}
+	r.add(OpSymlink, path, target)
+	return nil
+}
+
+// link ensures path is a symlink pointing out of the destination directory to target.
+func (r *reconciler) link(path, target string, exists bool) error {
+	target, err := r.targets.target(path, target)
+	if err != nil {
+		return err
+	}
+	return r.symlink(path, target, exists)
+}
+
+// ownedLink is like link for an entry outside of GOPATH/src. The entry is recorded as belonging to
+// vgopath unless it is a foreign entry that is kept.
+func (r *reconciler) ownedLink(path, target string) error {
+	n := len(r.ops)
+	if err := r.link(path, target, true); err != nil {
+		return err
+	}
+	if len(r.ops) > n || r.merge.owns(path) {
+		r.links = append(r.links, path)
+	}
+	return nil
+}
+
+// prune removes all entries of the directory at path that are not in keep. In merge mode,
+// only entries created by vgopath are removed.
+func (r *reconciler) prune(path string, keep map[string]struct{}) error {
+	entries, err := os.ReadDir(filepath.Join(r.root, path))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if _, ok := keep[entry.Name()]; ok {
+			continue
+		}
+
+		entryPath := filepath.Join(path, entry.Name())
+		if r.merge.owns(entryPath) {
+			r.add(OpRemove, entryPath, "")
+			continue
+		}
+		// A foreign directory may still contain entries of modules linked before.
+		for _, owned := range r.merge.ownedBelow(entryPath) {
+			r.add(OpRemove, owned, "")
+		}
+	}
+	return nil
+}
+
+// nodes ensures the directory at path contains exactly the given nodes.
+func (r *reconciler) nodes(path string, nodes []Node, exists bool) error {
+	if exists {
+		keep := make(map[string]struct{}, len(nodes))
+		for _, node := range nodes {
+			keep[node.Segment] = struct{}{}
+		}
+		if err := r.prune(path, keep); err != nil {
+			return err
+		}
+	}
+	return r.linkNodes(path, nodes, exists)
+}
+
+// linkNodes links the sibling nodes concurrently. Their changes are recorded in the order of the nodes.
+func (r *reconciler) linkNodes(dir string, nodes []Node, exists bool) error {
+	forks := make([]*reconciler, len(nodes))
+	if err := r.jobs.run(len(nodes), func(i int) error {
+		forks[i] = r.fork()
+		if err := forks[i].linkNode(dir, nodes[i], exists); err != nil {
+			return joinLinkNodeError(nodes[i], err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, fork := range forks {
+		r.ops = append(r.ops, fork.ops...)
+		r.modules = append(r.modules, fork.modules...)
+	}
+	return nil
+}
+
+// linkNode ensures the directory of the node contains every entry of its module, materialized
+// in the mode of the module, and the directories of its children.
+func (r *reconciler) linkNode(dir string, node Node, parentExists bool) error {
+	path := filepath.Join(dir, node.Segment)
+
+	exists := false
+	if parentExists {
+		var err error
+		if exists, err = r.dir(path); err != nil {
+			if errors.Is(err, errSkip) {
+				return nil
+			}
+			return err
+		}
+	} else {
+		r.add(OpMkdir, path, "")
+	}
+
+	keep := make(map[string]struct{}, len(node.Children))
+	for _, child := range node.Children {
+		keep[child.Segment] = struct{}{}
+	}
+
+	var (
+		mode    Mode
+		entries []fs.DirEntry
+	)
+	if node.Module != nil {
+		mode = r.modes.modeFor(node.Module)
+
+		var err error
+		entries, err = os.ReadDir(node.Module.Dir)
+		if err != nil {
+			return err
+		}
+		if mode != ModeSymlink {
+			if entries, err = r.withoutRoot(node.Module.Dir, entries); err != nil {
+				return err
+			}
+		}
+	}
+
+	var links []fs.DirEntry
+	for _, entry := range entries {
+		// skip linking directories of the module hierarchy, they will be handled by a dedicated call
+		if _, ok := keep[entry.Name()]; ok {
+			continue
+		}
+		links = append(links, entry)
+	}
+	for _, entry := range links {
+		keep[entry.Name()] = struct{}{}
+	}
+
+	if exists {
+		if err := r.prune(path, keep); err != nil {
+			return err
+		}
+	}
+
+	if node.Module != nil {
+		entryPaths := make([]string, 0, len(links))
+		for _, entry := range links {
+			entryPath := filepath.Join(path, entry.Name())
+			srcPath := filepath.Join(node.Module.Dir, entry.Name())
+			if err := r.materialize(entryPath, srcPath, mode, exists); err != nil {
+				if errors.Is(err, errSkip) {
+					continue
+				}
+				return err
+			}
+			entryPaths = append(entryPaths, entryPath)
+		}
+
+		r.modules = append(r.modules, ManifestModule{
+			Path:    node.Module.Path,
+			Version: node.Module.Version,
+			Dir:     node.Module.Dir,
+			Mode:    mode,
+			Entries: entryPaths,
+		})
+	}
+	return r.linkNodes(path, node.Children, exists)
+}
+
+// stage builds the nodes from scratch in a staging directory next to path and swaps it in for path.
+func (r *reconciler) stage(path string, nodes []Node) error {
+	staging := path + stagingSuffix
+	info, err := r.lstat(staging)
+	if err != nil {
+		return err
+	}
+	if info != nil {
+		// Left over by an interrupted run.
+		r.add(OpRemove, staging, "")
+	}
+	r.add(OpMkdir, staging, "")
+	r.staging = staging
+
+	n := len(r.modules)
+	if err := r.nodes(staging, nodes, false); err != nil {
+		return err
+	}
+	r.add(OpSwap, path, staging)
+
+	// The entries end up at path once swapped in.
+	for i := n; i < len(r.modules); i++ {
+		for j, entry := range r.modules[i].Entries {
+			if rest, ok := cutPathPrefix(entry, staging); ok {
+				r.modules[i].Entries[j] = filepath.Join(path, rest)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *reconciler) plan() *Plan {
+	ops := r.ops
+	if ops == nil {
+		ops = []Op{}
+	}
+	return &Plan{DstDir: r.root, Ops: ops, Staging: r.staging}
+}
@@ -0,0 +1,16 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package link
+
+import (
+	"errors"
+	"os"
+)
+
+// cloneFile is not supported outside of Linux, callers fall back to copying.
+func cloneFile(_, _ *os.File) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type prefixRule struct {
+	host   string
+	target string
+}
+
+// linkTargets computes the targets of the symlinks pointing out of the destination directory.
+type linkTargets struct {
+	// relative makes the targets relative to the directory containing the symlink.
+	relative bool
+	// prefixes rewrite host paths to the paths at the target location, longest host prefix first.
+	prefixes []prefixRule
+	// root is the location of the destination directory.
+	root string
+}
+
+func newLinkTargets(root string, opts Options) (*linkTargets, error) {
+	if !opts.RelativeLinks && len(opts.MapPrefixes) == 0 {
+		return nil, nil
+	}
+
+	prefixes, err := parsePrefixRules(opts.MapPrefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &linkTargets{relative: opts.RelativeLinks, prefixes: prefixes}
+	if t.root, err = t.location(root); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func parsePrefixRules(rules []string) ([]prefixRule, error) {
+	res := make([]prefixRule, 0, len(rules))
+	for _, rule := range rules {
+		host, target, ok := strings.Cut(rule, "=")
+		if !ok || !filepath.IsAbs(host) || !filepath.IsAbs(target) {
+			return nil, fmt.Errorf("invalid prefix mapping %q, must be <host prefix>=<target prefix> with absolute paths", rule)
+		}
+		res = append(res, prefixRule{host: filepath.Clean(host), target: filepath.Clean(target)})
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return len(res[i].host) > len(res[j].host)
+	})
+	return res, nil
+}
+
+// mapPrefix rewrites the absolute path with the longest matching prefix rule.
+func (t *linkTargets) mapPrefix(path string) (string, bool) {
+	for _, rule := range t.prefixes {
+		if rest, ok := cutPathPrefix(path, rule.host); ok {
+			return filepath.Join(rule.target, rest), true
+		}
+	}
+	return "", false
+}
+
+// cutPathPrefix returns path without prefix if path is prefix or below it.
+func cutPathPrefix(path, prefix string) (string, bool) {
+	if path == prefix {
+		return "", true
+	}
+	if prefix == string(filepath.Separator) {
+		return strings.TrimPrefix(path, prefix), true
+	}
+	rest, ok := strings.CutPrefix(path, prefix+string(filepath.Separator))
+	return rest, ok
+}
+
+// location returns the absolute path of the host path at the target location. Paths matching
+// a prefix rule are rewritten without looking at the host filesystem. Otherwise, symlinks are
+// resolved for relative links, as the kernel resolves '..' from the real location.
+func (t *linkTargets) location(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	if mapped, ok := t.mapPrefix(path); ok {
+		return mapped, nil
+	}
+	if t.relative {
+		return realPath(path)
+	}
+	return path, nil
+}
+
+// target returns the target to write for a symlink at path, relative to the destination directory,
+// pointing to target.
+func (t *linkTargets) target(path, target string) (string, error) {
+	if t == nil {
+		return target, nil
+	}
+
+	target, err := t.location(target)
+	if err != nil {
+		return "", err
+	}
+	if !t.relative {
+		return target, nil
+	}
+
+	// Below the root, all directories are created by us and thus are no symlinks.
+	dir := filepath.Join(t.root, filepath.Dir(path))
+	return filepath.Rel(dir, target)
+}
+
+// realPath returns the absolute path with all symlinks resolved. Trailing components that
+// do not exist are kept as they are.
+func realPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, missing...)...), nil
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ironcore-dev/vgopath/internal/module"
+)
+
+// trieNode is a node of the tree of module paths, with its children indexed by segment.
+type trieNode struct {
+	segment  string
+	module   *module.Module
+	children map[string]*trieNode
+}
+
+// insert adds the module at the node of its path below t.
+func (t *trieNode) insert(mod *module.Module) error {
+	node := t
+	for segment := range strings.SplitSeq(mod.Path, "/") {
+		child, ok := node.children[segment]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[string]*trieNode)
+			}
+			child = &trieNode{segment: segment}
+			node.children[segment] = child
+		}
+		node = child
+	}
+
+	if node.module != nil {
+		return fmt.Errorf("cannot insert module %s into node %s: module %s already exists", mod.Path, node.segment, node.module.Path)
+	}
+	node.module = mod
+	return nil
+}
+
+// nodes returns the children of t as nodes, sorted by segment.
+func (t *trieNode) nodes() []Node {
+	if len(t.children) == 0 {
+		return nil
+	}
+
+	res := make([]Node, 0, len(t.children))
+	for _, child := range t.children {
+		res = append(res, Node{
+			Segment:  child.segment,
+			Module:   child.module,
+			Children: child.nodes(),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Segment < res[j].Segment })
+	return res
+}
@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package link
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// VerifyReport lists the differences between a destination directory and the tree Link would produce.
+type VerifyReport struct {
+	// NoManifest is set if the destination directory has no manifest to compare the modules with.
+	NoManifest bool `json:",omitempty"`
+	// AddedModules are required by the project but not linked.
+	AddedModules []ManifestModule `json:",omitempty"`
+	// RemovedModules are linked but not required by the project anymore.
+	RemovedModules []ManifestModule `json:",omitempty"`
+	// ChangedModules are linked with a different version or directory than required by the project.
+	ChangedModules []ModuleChange `json:",omitempty"`
+	// Dangling are symlinks whose target does not exist.
+	Dangling []string `json:",omitempty"`
+	// Foreign are entries that do not belong to the tree.
+	Foreign []string `json:",omitempty"`
+	// Outdated are entries that are missing or differ from the tree.
+	Outdated []string `json:",omitempty"`
+}
+
+// ModuleChange describes a module linked differently than required.
+type ModuleChange struct {
+	Path       string
+	OldVersion string `json:",omitempty"`
+	NewVersion string `json:",omitempty"`
+	OldDir     string
+	NewDir     string
+}
+
+// OK reports whether the destination directory matches the tree.
+func (r *VerifyReport) OK() bool {
+	return !r.NoManifest &&
+		len(r.AddedModules) == 0 &&
+		len(r.RemovedModules) == 0 &&
+		len(r.ChangedModules) == 0 &&
+		len(r.Dangling) == 0 &&
+		len(r.Foreign) == 0 &&
+		len(r.Outdated) == 0
+}
+
+// Verify compares the destination directory with the tree Link would produce, without changing it.
+// It holds a shared lock on dstDir, so it does not observe a tree that is being linked. A directory
+// without marker is verified without the lock, so no lock file is created in it.
+func Verify(dstDir string, opts Options) (*VerifyReport, error) {
+	marked, err := IsMarked(dstDir)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		return verify(dstDir, opts)
+	}
+
+	var report *VerifyReport
+	err = locked(dstDir, false, func() error {
+		var err error
+		report, err = verify(dstDir, opts)
+		return err
+	})
+	return report, err
+}
+
+func verify(dstDir string, opts Options) (*VerifyReport, error) {
+	// Nothing is changed, so a missing marker is only reported. The tree is compared in place.
+	opts.Force = true
+	opts.Atomic = false
+	plan, err := PlanLink(dstDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{}
+	// If GOPATH/src is skipped, the modules of the plan are the ones of the manifest.
+	if !opts.SkipGoSrc {
+		manifest, err := ReadManifest(dstDir)
+		if err != nil {
+			return nil, err
+		}
+		if manifest == nil {
+			report.NoManifest = true
+		} else {
+			compareModules(report, manifest.Modules, plan.Manifest.Modules)
+		}
+	}
+
+	compareOps(report, plan.Ops)
+
+	// Mapped targets only resolve at the target location. GOPATH/bin and GOPATH/pkg are not
+	// checked, as GOBIN does not have to exist.
+	if !opts.SkipGoSrc && len(opts.MapPrefixes) == 0 {
+		if report.Dangling, err = danglingSymlinks(dstDir); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+func compareModules(report *VerifyReport, linked, required []ManifestModule) {
+	linkedByPath := make(map[string]ManifestModule, len(linked))
+	for _, mod := range linked {
+		linkedByPath[mod.Path] = mod
+	}
+
+	requiredPaths := make(map[string]struct{}, len(required))
+	for _, mod := range required {
+		requiredPaths[mod.Path] = struct{}{}
+
+		old, ok := linkedByPath[mod.Path]
+		switch {
+		case !ok:
+			report.AddedModules = append(report.AddedModules, mod)
+		case old.Version != mod.Version || old.Dir != mod.Dir:
+			report.ChangedModules = append(report.ChangedModules, ModuleChange{
+				Path:       mod.Path,
+				OldVersion: old.Version,
+				NewVersion: mod.Version,
+				OldDir:     old.Dir,
+				NewDir:     mod.Dir,
+			})
+		}
+	}
+
+	for _, mod := range linked {
+		if _, ok := requiredPaths[mod.Path]; !ok {
+			report.RemovedModules = append(report.RemovedModules, mod)
+		}
+	}
+}
+
+// compareOps sorts the destinations of the operations into foreign entries, which are only removed,
+// and outdated entries, which are created.
+func compareOps(report *VerifyReport, ops []Op) {
+	created := make(map[string]struct{})
+	for _, op := range ops {
+		if op.Kind != OpRemove {
+			created[op.Destination] = struct{}{}
+		}
+	}
+
+	outdated := make(map[string]struct{})
+	for _, op := range ops {
+		if _, ok := created[op.Destination]; !ok {
+			report.Foreign = append(report.Foreign, op.Destination)
+			continue
+		}
+		if _, ok := outdated[op.Destination]; !ok {
+			outdated[op.Destination] = struct{}{}
+			report.Outdated = append(report.Outdated, op.Destination)
+		}
+	}
+}
+
+// danglingSymlinks returns the paths of the symlinks below GOPATH/src whose target does not exist,
+// relative to dstDir.
+func danglingSymlinks(dstDir string) ([]string, error) {
+	var res []string
+	err := filepath.WalkDir(filepath.Join(dstDir, "src"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			rel, err := filepath.Rel(dstDir, path)
+			if err != nil {
+				return err
+			}
+			res = append(res, rel)
+		}
+		return nil
+	})
+	return res, err
+}
@@ -0,0 +1,215 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+type DownloadOptions struct {
+	// GoCommand configures the go command invocation.
+	GoCommand GoCommandOptions
+
+	Dir      string
+	WorkFile string
+	// Command creates the command to run with the given go arguments.
+	Command func(args ...string) *exec.Cmd
+}
+
+func (o *DownloadOptions) ApplyToDownload(o2 *DownloadOptions) {
+	o.GoCommand.applyToGoCommand(&o2.GoCommand)
+	if o.Dir != "" {
+		o2.Dir = o.Dir
+	}
+	if o.WorkFile != "" {
+		o2.WorkFile = o.WorkFile
+	}
+	if o.Command != nil {
+		o2.Command = o.Command
+	}
+}
+
+func (o *DownloadOptions) ApplyOptions(opts []DownloadOption) {
+	for _, opt := range opts {
+		opt.ApplyToDownload(o)
+	}
+}
+
+type DownloadOption interface {
+	ApplyToDownload(o *DownloadOptions)
+}
+
+func (d InDir) ApplyToDownload(o *DownloadOptions) {
+	o.Dir = string(d)
+}
+
+func (w WithWorkFile) ApplyToDownload(o *DownloadOptions) {
+	o.WorkFile = string(w)
+}
+
+func setDownloadDefaults(o *DownloadOptions) {
+	if o.Dir == "" {
+		o.Dir = "."
+	}
+	if o.Command == nil {
+		goBinary := o.GoCommand.goBinary()
+		o.Command = func(args ...string) *exec.Cmd {
+			return exec.Command(goBinary, args...)
+		}
+	}
+}
+
+// DownloadError lists the modules that could not be downloaded.
+type DownloadError struct {
+	// Modules are the modules that failed to download, with their Error set.
+	Modules []Module
+}
+
+func (e *DownloadError) Error() string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "error downloading %d module(s):", len(e.Modules))
+	for _, mod := range e.Modules {
+		_, _ = fmt.Fprintf(&sb, "\n\t%s: %v", mod.String(), mod.Error)
+	}
+	return sb.String()
+}
+
+// downloadTarget returns the module version that has to be downloaded for mod.
+func downloadTarget(mod Module) (Module, error) {
+	if mod.Replace != nil {
+		if mod.Replace.Version == "" {
+			return Module{}, fmt.Errorf("replacement directory %s does not exist", mod.Replace.Path)
+		}
+		return *mod.Replace, nil
+	}
+	if mod.Version == "" {
+		return Module{}, fmt.Errorf("module has no version")
+	}
+	return mod, nil
+}
+
+// Download runs 'go mod download -json' for the given modules and returns them with the Dir
+// reported by the go command. Replaced modules download their replacement. If any module
+// could not be downloaded, a *DownloadError listing all of them is returned.
+func Download(mods []Module, opts ...DownloadOption) ([]Module, error) {
+	o := &DownloadOptions{}
+	o.ApplyOptions(opts)
+	setDownloadDefaults(o)
+
+	var (
+		failed  []Module
+		args    = []string{"mod", "download", "-json"}
+		targets = make(map[string]Module)
+	)
+	for _, mod := range mods {
+		target, err := downloadTarget(mod)
+		if err != nil {
+			mod.Error = &Error{Err: err.Error()}
+			failed = append(failed, mod)
+			continue
+		}
+
+		key := target.String()
+		if _, ok := targets[key]; !ok {
+			args = append(args, key)
+		}
+		targets[key] = target
+	}
+
+	downloaded := make(map[string]Module)
+	if len(targets) > 0 {
+		var err error
+		downloaded, err = runDownload(o, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res := make([]Module, 0, len(mods))
+	for _, mod := range mods {
+		target, err := downloadTarget(mod)
+		if err != nil {
+			continue
+		}
+
+		info, ok := downloaded[target.String()]
+		switch {
+		case !ok:
+			mod.Error = &Error{Err: "not reported by go mod download"}
+		case info.Error != nil:
+			mod.Error = info.Error
+		case info.Dir == "":
+			mod.Error = &Error{Err: "no directory reported by go mod download"}
+		}
+		if mod.Error != nil {
+			failed = append(failed, mod)
+			continue
+		}
+
+		mod.Dir = info.Dir
+		if mod.Replace != nil {
+			// Replace is shared with the caller's module, so update a copy.
+			replace := *mod.Replace
+			replace.Dir = info.Dir
+			mod.Replace = &replace
+		}
+		res = append(res, mod)
+	}
+
+	if len(failed) > 0 {
+		return nil, &DownloadError{Modules: failed}
+	}
+	return res, nil
+}
+
+type downloadInfo struct {
+	Path    string
+	Version string
+	Dir     string
+	Error   string
+}
+
+func runDownload(o *DownloadOptions, args []string) (map[string]Module, error) {
+	cmd := o.Command(args...)
+	cmd.Dir = o.Dir
+	if o.WorkFile != "" {
+		cmd.Env = append(cmdEnv(cmd), "GOWORK="+o.WorkFile)
+	}
+	o.GoCommand.setEnv(cmd)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	// go mod download exits non-zero if any module fails but still reports every module.
+	res := make(map[string]Module)
+	dec := json.NewDecoder(&stdout)
+	for {
+		var info downloadInfo
+		if err := dec.Decode(&info); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("error decoding go mod download output: %w", err)
+		}
+
+		mod := Module{Path: info.Path, Version: info.Version, Dir: info.Dir}
+		if info.Error != "" {
+			mod.Error = &Error{Err: info.Error}
+		}
+		res[mod.String()] = mod
+	}
+
+	if runErr != nil && len(res) == 0 {
+		return nil, fmt.Errorf("error running go mod download: %w: %s", runErr, strings.TrimSpace(stderr.String()))
+	}
+	return res, nil
+}
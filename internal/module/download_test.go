@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module_test
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/ironcore-dev/vgopath/internal/module"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	xmodule "golang.org/x/mod/module"
+)
+
+var _ = Describe("Download", func() {
+	var (
+		proxyDir string
+		modCache string
+		goCmd    func(args ...string) *exec.Cmd
+	)
+	BeforeEach(func() {
+		proxyDir = GinkgoT().TempDir()
+		modCache = GinkgoT().TempDir()
+
+		Expect(writeProxyModule(proxyDir, "example.org/a", "v1.0.0", map[string]string{
+			"a.go": "package a\n",
+		})).To(Succeed())
+		Expect(writeProxyModule(proxyDir, "example.org/Upper", "v1.1.0", map[string]string{
+			"upper.go": "package upper\n",
+		})).To(Succeed())
+
+		goCmd = func(args ...string) *exec.Cmd {
+			cmd := exec.Command("go", args...)
+			cmd.Env = append(os.Environ(),
+				"GOPROXY=file://"+filepath.ToSlash(proxyDir),
+				"GOMODCACHE="+modCache,
+				"GOFLAGS=-modcacherw",
+				"GONOSUMDB=*",
+				"GOSUMDB=off",
+				"GOWORK=off",
+			)
+			return cmd
+		}
+	})
+
+	It("should download the modules and report their directory", func() {
+		in := []module.Module{
+			{Path: "example.org/a", Version: "v1.0.0"},
+			{Path: "example.org/b", Version: "v1.0.0", Replace: &module.Module{Path: "example.org/Upper", Version: "v1.1.0"}},
+		}
+		mods, err := module.Download(in, module.InDir(GinkgoT().TempDir()), &module.DownloadOptions{Command: goCmd})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("leaving the input modules unchanged")
+		Expect(in).To(Equal([]module.Module{
+			{Path: "example.org/a", Version: "v1.0.0"},
+			{Path: "example.org/b", Version: "v1.0.0", Replace: &module.Module{Path: "example.org/Upper", Version: "v1.1.0"}},
+		}))
+
+		Expect(mods).To(HaveLen(2))
+		Expect(mods[0].Dir).To(Equal(filepath.Join(modCache, "example.org", "a@v1.0.0")))
+		Expect(filepath.Join(mods[0].Dir, "a.go")).To(BeARegularFile())
+		Expect(mods[1].Dir).To(Equal(filepath.Join(modCache, "example.org", "!upper@v1.1.0")))
+		Expect(mods[1].Replace.Dir).To(Equal(mods[1].Dir))
+	})
+
+	It("should list every module that could not be downloaded", func() {
+		_, err := module.Download([]module.Module{
+			{Path: "example.org/a", Version: "v1.0.0"},
+			{Path: "example.org/missing", Version: "v1.0.0"},
+			{Path: "example.org/local", Version: "v1.0.0", Replace: &module.Module{Path: "../local"}},
+		}, module.InDir(GinkgoT().TempDir()), &module.DownloadOptions{Command: goCmd})
+
+		var downloadErr *module.DownloadError
+		Expect(errors.As(err, &downloadErr)).To(BeTrue())
+		Expect(modulePaths(downloadErr.Modules)).To(ConsistOf("example.org/missing", "example.org/local"))
+		Expect(err.Error()).To(And(
+			ContainSubstring("example.org/missing@v1.0.0"),
+			ContainSubstring("example.org/local@v1.0.0: replacement directory ../local does not exist"),
+		))
+	})
+})
+
+// writeProxyModule writes a module version in the layout of a GOPROXY file:// directory.
+func writeProxyModule(proxyDir, path, version string, files map[string]string) error {
+	escPath, err := xmodule.EscapePath(path)
+	if err != nil {
+		return err
+	}
+	versionDir := filepath.Join(proxyDir, filepath.FromSlash(escPath), "@v")
+	goMod := "module " + path + "\n"
+
+	if err := writeFiles(versionDir, map[string]string{
+		"list":            version + "\n",
+		version + ".info": `{"Version":"` + version + `","Time":"2023-01-02T03:04:05Z"}`,
+		version + ".mod":  goMod,
+	}); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(versionDir, version+".zip"))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	zw := zip.NewWriter(f)
+	files["go.mod"] = goMod
+	for name, content := range files {
+		w, err := zw.Create(path + "@" + version + "/" + name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// Stdin is the file name that makes OpenFile read from standard input.
+const Stdin = "-"
+
+type jsonReader struct {
+	dec *json.Decoder
+}
+
+// NewJSONReader returns a Reader decoding the 'go list -m -json' stream format from r.
+func NewJSONReader(r io.Reader) Reader {
+	return &jsonReader{dec: json.NewDecoder(r)}
+}
+
+func (r *jsonReader) Read(data []Module) (int, error) {
+	for i := 0; i < len(data); i++ {
+		if err := decodeModule(r.dec, &data[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(data), nil
+}
+
+// decodeModule decodes the next module of dec into mod.
+func decodeModule(dec *json.Decoder, mod *Module) error {
+	// Decoding merges into the existing value, so clear what a previous read left behind.
+	*mod = Module{}
+	return dec.Decode(mod)
+}
+
+type fileReadCloser struct {
+	Reader
+	file *os.File
+}
+
+func (r *fileReadCloser) Close() error {
+	if r.file == os.Stdin {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// OpenFile opens a file in the 'go list -m -json' stream format.
+// If name is Stdin, the modules are read from standard input, which is not closed by Close.
+func OpenFile(name string) (ReadCloser, error) {
+	if name == Stdin {
+		return &fileReadCloser{Reader: NewJSONReader(os.Stdin), file: os.Stdin}, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &fileReadCloser{Reader: NewJSONReader(f), file: f}, nil
+}
+
+func ReadAllFileModules(name string) ([]Module, error) {
+	rc, err := OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+
+	return ReadAll(rc)
+}
@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// DefaultGoBinary is the go binary used if none is configured.
+const DefaultGoBinary = "go"
+
+// GoCommandOptions configure the invocation of the go command.
+type GoCommandOptions struct {
+	// GoBinary is the path of the go binary. Defaults to DefaultGoBinary.
+	GoBinary string
+	// GoToolchain is passed as GOTOOLCHAIN.
+	GoToolchain string
+	// GoFlags are appended to the GOFLAGS of the environment.
+	GoFlags []string
+	// ModFile is passed as -modfile flag via GOFLAGS.
+	ModFile string
+	// GOOS and GOARCH are passed as environment variables of the same name.
+	GOOS   string
+	GOARCH string
+	// Env are additional KEY=VALUE environment variables. They take precedence over all others.
+	Env []string
+}
+
+func (o *GoCommandOptions) applyToGoCommand(o2 *GoCommandOptions) {
+	if o.GoBinary != "" {
+		o2.GoBinary = o.GoBinary
+	}
+	if o.GoToolchain != "" {
+		o2.GoToolchain = o.GoToolchain
+	}
+	o2.GoFlags = append(o2.GoFlags, o.GoFlags...)
+	if o.ModFile != "" {
+		o2.ModFile = o.ModFile
+	}
+	if o.GOOS != "" {
+		o2.GOOS = o.GOOS
+	}
+	if o.GOARCH != "" {
+		o2.GOARCH = o.GOARCH
+	}
+	o2.Env = append(o2.Env, o.Env...)
+}
+
+func (o *GoCommandOptions) ApplyToOpenGoList(o2 *OpenGoListOptions) {
+	o.applyToGoCommand(&o2.GoCommand)
+}
+
+func (o *GoCommandOptions) ApplyToDownload(o2 *DownloadOptions) {
+	o.applyToGoCommand(&o2.GoCommand)
+}
+
+func (o *GoCommandOptions) goBinary() string {
+	if o.GoBinary == "" {
+		return DefaultGoBinary
+	}
+	return o.GoBinary
+}
+
+// setEnv adds the configured environment to cmd.
+func (o *GoCommandOptions) setEnv(cmd *exec.Cmd) {
+	var env []string
+	if o.GoToolchain != "" {
+		env = append(env, "GOTOOLCHAIN="+o.GoToolchain)
+	}
+	if o.GOOS != "" {
+		env = append(env, "GOOS="+o.GOOS)
+	}
+	if o.GOARCH != "" {
+		env = append(env, "GOARCH="+o.GOARCH)
+	}
+
+	flags := o.GoFlags
+	if o.ModFile != "" {
+		flags = append(flags[:len(flags):len(flags)], "-modfile="+o.ModFile)
+	}
+	if len(flags) > 0 {
+		base := lookupEnv(cmdEnv(cmd), "GOFLAGS")
+		env = append(env, "GOFLAGS="+joinGoFlags(base, flags))
+	}
+
+	env = append(env, o.Env...)
+	if len(env) > 0 {
+		cmd.Env = append(cmdEnv(cmd), env...)
+	}
+}
+
+// ModFlag returns the value of the -mod flag in the GOFLAGS the go command is invoked with, if any.
+func (o *GoCommandOptions) ModFlag() string {
+	cmd := &exec.Cmd{}
+	o.setEnv(cmd)
+
+	var mod string
+	for _, flag := range strings.Fields(lookupEnv(cmdEnv(cmd), "GOFLAGS")) {
+		// Like any go flag, -mod may also be written with two dashes.
+		flag = strings.TrimPrefix(strings.TrimPrefix(flag, "-"), "-")
+		if value, ok := strings.CutPrefix(flag, "mod="); ok {
+			mod = value
+		}
+	}
+	return mod
+}
+
+// joinGoFlags appends flags to the GOFLAGS value base, quoting flags containing whitespace.
+func joinGoFlags(base string, flags []string) string {
+	parts := make([]string, 0, len(flags)+1)
+	if base = strings.TrimSpace(base); base != "" {
+		parts = append(parts, base)
+	}
+	for _, flag := range flags {
+		if strings.ContainsAny(flag, " \t\n\r") {
+			if strings.Contains(flag, "'") {
+				flag = `"` + flag + `"`
+			} else {
+				flag = "'" + flag + "'"
+			}
+		}
+		parts = append(parts, flag)
+	}
+	return strings.Join(parts, " ")
+}
+
+// lookupEnv returns the last value of key in env, like the environment of a started command.
+func lookupEnv(env []string, key string) string {
+	var value string
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == key {
+			value = v
+		}
+	}
+	return value
+}
+
+// GoVersion returns the GOVERSION reported by the configured go command when run in dir.
+func GoVersion(dir string, o *GoCommandOptions) (string, error) {
+	cmd := exec.Command(o.goBinary(), "env", "GOVERSION")
+	cmd.Dir = dir
+	o.setEnv(cmd)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error running go env: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/ironcore-dev/vgopath/internal/module"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GoCommandOptions", func() {
+	It("should invoke the configured go binary with the configured environment", func() {
+		binDir := GinkgoT().TempDir()
+		goBinary := filepath.Join(binDir, "go")
+		Expect(os.WriteFile(goBinary, []byte(`#!/bin/sh
+printf '{"Path": "%s", "Version": "%s", "GoVersion": "%s"}\n' "$*" "$GOTOOLCHAIN $GOOS $GOARCH $FOO" "$GOFLAGS"
+`), 0755)).To(Succeed())
+		GinkgoT().Setenv("GOFLAGS", "-mod=mod")
+
+		mods, err := module.ReadAllGoListModules(&module.GoCommandOptions{
+			GoBinary:    goBinary,
+			GoToolchain: "go1.22.0",
+			GoFlags:     []string{"-tags=tools"},
+			ModFile:     "/hack/my tools/go.mod",
+			GOOS:        "plan9",
+			GOARCH:      "arm",
+			Env:         []string{"FOO=bar", "GOOS=windows"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mods).To(Equal([]module.Module{{
+			Path:      "list -m -json all",
+			Version:   "go1.22.0 windows arm bar",
+			GoVersion: "-mod=mod -tags=tools '-modfile=/hack/my tools/go.mod'",
+		}}))
+	})
+
+	It("should list the modules of an alternate go.mod file", func() {
+		dir := GinkgoT().TempDir()
+		Expect(writeFiles(dir, map[string]string{
+			"go.mod":            "module example.org/main\n\ngo 1.22\n",
+			"hack/tools/go.mod": "module example.org/tools\n\ngo 1.22\n",
+		})).To(Succeed())
+		GinkgoT().Setenv("GOFLAGS", "")
+		GinkgoT().Setenv("GOWORK", "off")
+
+		mods, err := module.ReadAllGoListModules(module.InDir(dir), &module.GoCommandOptions{
+			ModFile: filepath.Join(dir, "hack", "tools", "go.mod"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(modulePaths(mods)).To(Equal([]string{"example.org/tools"}))
+	})
+
+	Describe("ModFlag", func() {
+		It("should return the last -mod flag of GOFLAGS and the configured go flags", func() {
+			GinkgoT().Setenv("GOFLAGS", "-mod=vendor -tags=tools")
+			Expect((&module.GoCommandOptions{}).ModFlag()).To(Equal("vendor"))
+			Expect((&module.GoCommandOptions{GoFlags: []string{"--mod=readonly"}}).ModFlag()).To(Equal("readonly"))
+		})
+
+		It("should let a GOFLAGS environment variable take precedence", func() {
+			GinkgoT().Setenv("GOFLAGS", "-mod=vendor")
+			Expect((&module.GoCommandOptions{
+				GoFlags: []string{"-mod=vendor"},
+				Env:     []string{"GOFLAGS=-mod=mod"},
+			}).ModFlag()).To(Equal("mod"))
+		})
+
+		It("should return an empty string if -mod is not set", func() {
+			GinkgoT().Setenv("GOFLAGS", "-tags=tools")
+			Expect((&module.GoCommandOptions{}).ModFlag()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// maxStderrSize is the maximum number of bytes of stderr kept for error reporting.
+const maxStderrSize = 64 * 1024
+
+// Diagnostic is an error message printed by the go command.
+type Diagnostic struct {
+	// Module is the module version the diagnostic refers to, if any.
+	Module string
+	// Message is the diagnostic message, including indented continuation lines.
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Module == "" {
+		return d.Message
+	}
+	return d.Module + ": " + d.Message
+}
+
+// GoListError is returned if go list exits with a non-zero status.
+type GoListError struct {
+	ExitCode    int
+	Stderr      string
+	Diagnostics []Diagnostic
+
+	err error
+}
+
+func (e *GoListError) Error() string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "go list failed with exit code %d", e.ExitCode)
+	switch {
+	case len(e.Diagnostics) > 0:
+		for _, d := range e.Diagnostics {
+			_, _ = fmt.Fprintf(&sb, "\n\t%s", strings.ReplaceAll(d.String(), "\n", "\n\t"))
+		}
+	case e.Stderr != "":
+		_, _ = fmt.Fprintf(&sb, ": %s", strings.TrimSpace(e.Stderr))
+	}
+	return sb.String()
+}
+
+// Unwrap returns the underlying *exec.ExitError.
+func (e *GoListError) Unwrap() error {
+	return e.err
+}
+
+func newGoListError(exitCode int, stderr string, err error) *GoListError {
+	return &GoListError{
+		ExitCode:    exitCode,
+		Stderr:      stderr,
+		Diagnostics: ParseDiagnostics(stderr),
+		err:         err,
+	}
+}
+
+// progressPrefixes start the progress messages of the go command, which are not diagnostics.
+var progressPrefixes = []string{
+	"downloading ",
+	"extracting ",
+	"finding module for package ",
+	"found ",
+}
+
+// ParseDiagnostics parses the error output of the go command. Every line that is not indented
+// starts a new diagnostic, indented lines continue the previous one. The 'go: ' prefix is removed and a
+// leading 'module@version: ' is split off into the Module field. Progress messages like
+// 'go: downloading module version' are dropped.
+func ParseDiagnostics(stderr string) []Diagnostic {
+	var (
+		res      []Diagnostic
+		progress bool
+		scanner  = bufio.NewScanner(strings.NewReader(stderr))
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, " ") {
+			if !progress && len(res) > 0 {
+				last := &res[len(res)-1]
+				last.Message += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+
+		line, isGo := strings.CutPrefix(line, "go: ")
+		if progress = isGo && isProgress(line); progress {
+			continue
+		}
+
+		var d Diagnostic
+		if mod, msg, ok := strings.Cut(line, ": "); ok && isModuleVersion(mod) {
+			d.Module, d.Message = mod, msg
+		} else {
+			d.Message = line
+		}
+		res = append(res, d)
+	}
+	return res
+}
+
+func isProgress(msg string) bool {
+	for _, prefix := range progressPrefixes {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isModuleVersion(s string) bool {
+	path, version, ok := strings.Cut(s, "@")
+	return ok && path != "" && version != "" && !strings.ContainsAny(s, " \t")
+}
+
+// cappedBuffer is an io.Writer keeping at most max bytes.
+type cappedBuffer struct {
+	max int
+	sb  strings.Builder
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if rest := b.max - b.sb.Len(); rest > 0 {
+		if len(p) > rest {
+			b.sb.Write(p[:rest])
+		} else {
+			b.sb.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string {
+	return b.sb.String()
+}
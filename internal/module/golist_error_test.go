@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module_test
+
+import (
+	"github.com/ironcore-dev/vgopath/internal/module"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GoListError", func() {
+	Describe("ParseDiagnostics", func() {
+		It("should split the go command output into diagnostics, dropping progress messages", func() {
+			stderr := `go: downloading example.org/a v1.0.0
+go: example.org/b@v1.2.3: missing go.sum entry for go.mod file; to add it:
+	go mod download example.org/b
+go: finding module for package example.org/d/pkg
+go: found example.org/d/pkg in example.org/d v1.0.0
+go: example.org/c@v0.0.0-00010101000000-000000000000: invalid version: unknown revision 000000000000
+`
+			Expect(module.ParseDiagnostics(stderr)).To(Equal([]module.Diagnostic{
+				{Module: "example.org/b@v1.2.3", Message: "missing go.sum entry for go.mod file; to add it:\ngo mod download example.org/b"},
+				{Module: "example.org/c@v0.0.0-00010101000000-000000000000", Message: "invalid version: unknown revision 000000000000"},
+			}))
+		})
+	})
+
+	It("should include the diagnostics in the error message", func() {
+		err := &module.GoListError{
+			ExitCode: 1,
+			Diagnostics: []module.Diagnostic{
+				{Module: "example.org/b@v1.2.3", Message: "missing go.sum entry"},
+			},
+		}
+		Expect(err.Error()).To(Equal("go list failed with exit code 1\n\texample.org/b@v1.2.3: missing go.sum entry"))
+	})
+
+	It("should fall back to stderr if there are no diagnostics", func() {
+		err := &module.GoListError{ExitCode: 2, Stderr: "something went wrong\n"}
+		Expect(err.Error()).To(Equal("go list failed with exit code 2: something went wrong"))
+	})
+})
@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"path"
+)
+
+// readBatchSize is the number of modules All reads at once.
+const readBatchSize = 64
+
+// All returns an iterator over the modules of r. Iteration ends once r returns io.EOF.
+// Any other error is yielded with a zero Module and ends the iteration.
+func All(r Reader) iter.Seq2[Module, error] {
+	return func(yield func(Module, error) bool) {
+		buf := make([]Module, readBatchSize)
+		for {
+			n, err := r.Read(buf)
+			for _, mod := range buf[:n] {
+				if !yield(mod, nil) {
+					return
+				}
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					yield(Module{}, err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// Collect gathers the modules of seq. On error, the modules up to the error are returned along with it.
+func Collect(seq iter.Seq2[Module, error]) ([]Module, error) {
+	var res []Module
+	for mod, err := range seq {
+		if err != nil {
+			return res, err
+		}
+		res = append(res, mod)
+	}
+	return res, nil
+}
+
+// Filter yields the modules of seq for which keep returns true. Errors are passed through.
+func Filter(seq iter.Seq2[Module, error], keep func(Module) bool) iter.Seq2[Module, error] {
+	return func(yield func(Module, error) bool) {
+		for mod, err := range seq {
+			if err == nil && !keep(mod) {
+				continue
+			}
+			if !yield(mod, err) {
+				return
+			}
+		}
+	}
+}
+
+// FilterPath yields the modules of seq whose path matches any of the path.Match patterns.
+func FilterPath(seq iter.Seq2[Module, error], patterns ...string) iter.Seq2[Module, error] {
+	return func(yield func(Module, error) bool) {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				yield(Module{}, fmt.Errorf("invalid pattern %q: %w", pattern, err))
+				return
+			}
+		}
+
+		Filter(seq, func(mod Module) bool {
+			for _, pattern := range patterns {
+				if ok, _ := path.Match(pattern, mod.Path); ok {
+					return true
+				}
+			}
+			return false
+		})(yield)
+	}
+}
+
+// ExcludeMain yields the modules of seq that are not main modules.
+func ExcludeMain(seq iter.Seq2[Module, error]) iter.Seq2[Module, error] {
+	return Filter(seq, func(mod Module) bool {
+		return !mod.Main
+	})
+}
+
+// MapDir replaces the Dir of every module of seq and its replacement by the result of f.
+// Empty directories are left untouched.
+func MapDir(seq iter.Seq2[Module, error], f func(dir string) string) iter.Seq2[Module, error] {
+	return func(yield func(Module, error) bool) {
+		for mod, err := range seq {
+			if err == nil {
+				mod = mapDir(mod, f)
+			}
+			if !yield(mod, err) {
+				return
+			}
+		}
+	}
+}
+
+func mapDir(mod Module, f func(dir string) string) Module {
+	if mod.Dir != "" {
+		mod.Dir = f(mod.Dir)
+	}
+	if mod.Replace != nil {
+		replace := mapDir(*mod.Replace, f)
+		mod.Replace = &replace
+	}
+	return mod
+}
+
+// Dedup yields only the first module of seq for every module path.
+func Dedup(seq iter.Seq2[Module, error]) iter.Seq2[Module, error] {
+	return func(yield func(Module, error) bool) {
+		seen := make(map[string]struct{})
+		Filter(seq, func(mod Module) bool {
+			if _, ok := seen[mod.Path]; ok {
+				return false
+			}
+			seen[mod.Path] = struct{}{}
+			return true
+		})(yield)
+	}
+}
+
+// Tee calls f for every module and error of seq before yielding it.
+func Tee(seq iter.Seq2[Module, error], f func(Module, error)) iter.Seq2[Module, error] {
+	return func(yield func(Module, error) bool) {
+		for mod, err := range seq {
+			f(mod, err)
+			if !yield(mod, err) {
+				return
+			}
+		}
+	}
+}
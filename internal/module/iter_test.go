@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+
+	"github.com/ironcore-dev/vgopath/internal/module"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// failingReader returns its modules, followed by err.
+type failingReader struct {
+	mods []module.Module
+	err  error
+}
+
+func (r *failingReader) Read(data []module.Module) (int, error) {
+	if len(r.mods) == 0 {
+		return 0, r.err
+	}
+	n := copy(data, r.mods)
+	r.mods = r.mods[n:]
+	return n, nil
+}
+
+var _ = Describe("Iter", func() {
+	var (
+		mainMod = module.Module{Path: "example.org/main", Main: true, Dir: "/src/main"}
+		modA    = module.Module{Path: "example.org/a", Version: "v1.0.0", Dir: "/cache/a"}
+		modB    = module.Module{
+			Path:    "other.org/b",
+			Version: "v1.0.0",
+			Replace: &module.Module{Path: "../b", Dir: "/src/b"},
+		}
+		errTest = errors.New("test error")
+	)
+
+	seq := func(mods ...module.Module) iter.Seq2[module.Module, error] {
+		return module.All(&failingReader{mods: mods, err: errTest})
+	}
+
+	Describe("All", func() {
+		It("should yield all modules followed by the read error", func() {
+			mods, err := module.Collect(seq(mainMod, modA, modB))
+			Expect(err).To(MatchError(errTest))
+			Expect(mods).To(Equal([]module.Module{mainMod, modA, modB}))
+		})
+
+		It("should stop reading once the consumer stops", func() {
+			for mod, err := range seq(mainMod, modA) {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mod).To(Equal(mainMod))
+				break
+			}
+		})
+
+		It("should read large sources in batches", func() {
+			mods := make([]module.Module, 1000)
+			for i := range mods {
+				mods[i] = modA
+			}
+
+			res, err := module.ReadAll(&failingReader{mods: mods, err: io.EOF})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(HaveLen(1000))
+		})
+
+		It("should not carry fields over between batches of a decoded stream", func() {
+			var (
+				stream strings.Builder
+				mods   = make([]module.Module, 100)
+			)
+			for i := range mods {
+				mods[i] = module.Module{Path: fmt.Sprintf("example.org/m%d", i), Version: "v1.0.0"}
+				// Like go list, only set fields are written. The first batch and the start of the second
+				// one are main and replaced modules.
+				if i < 70 {
+					mods[i].Main = true
+					mods[i].Replace = &module.Module{Path: "../m", Dir: "/src/m"}
+					_, _ = fmt.Fprintf(&stream, `{"Path": %q, "Version": "v1.0.0", "Main": true, "Replace": {"Path": "../m", "Dir": "/src/m"}}`+"\n", mods[i].Path)
+				} else {
+					_, _ = fmt.Fprintf(&stream, `{"Path": %q, "Version": "v1.0.0"}`+"\n", mods[i].Path)
+				}
+			}
+
+			res, err := module.ReadAll(module.NewJSONReader(strings.NewReader(stream.String())))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(mods))
+		})
+	})
+
+	Describe("FilterPath", func() {
+		It("should yield the modules matching any pattern", func() {
+			mods, _ := module.Collect(module.FilterPath(seq(mainMod, modA, modB), "example.org/*", "none"))
+			Expect(mods).To(Equal([]module.Module{mainMod, modA}))
+		})
+
+		It("should error on invalid patterns", func() {
+			_, err := module.Collect(module.FilterPath(seq(modA), "["))
+			Expect(err).To(MatchError(ContainSubstring(`invalid pattern "["`)))
+		})
+	})
+
+	Describe("ExcludeMain", func() {
+		It("should drop the main modules", func() {
+			mods, _ := module.Collect(module.ExcludeMain(seq(mainMod, modA)))
+			Expect(mods).To(Equal([]module.Module{modA}))
+		})
+	})
+
+	Describe("MapDir", func() {
+		It("should map the directories of the modules and their replacements", func() {
+			mods, _ := module.Collect(module.MapDir(seq(modA, modB), func(dir string) string {
+				return "/mnt" + dir
+			}))
+			Expect(mods).To(HaveLen(2))
+			Expect(mods[0].Dir).To(Equal("/mnt/cache/a"))
+			Expect(mods[1].Dir).To(BeEmpty())
+			Expect(mods[1].Replace.Dir).To(Equal("/mnt/src/b"))
+			Expect(modB.Replace.Dir).To(Equal("/src/b"), "should not modify the input")
+		})
+	})
+
+	Describe("Dedup", func() {
+		It("should only yield the first module of every path", func() {
+			other := module.Module{Path: modA.Path, Version: "v2.0.0"}
+			mods, _ := module.Collect(module.Dedup(seq(modA, modB, other, modB)))
+			Expect(mods).To(Equal([]module.Module{modA, modB}))
+		})
+	})
+
+	Describe("Tee", func() {
+		It("should pass every module and error to the function", func() {
+			var (
+				seen    []string
+				seenErr error
+			)
+			mods, err := module.Collect(module.Tee(module.ExcludeMain(seq(mainMod, modA)), func(mod module.Module, err error) {
+				if err != nil {
+					seenErr = err
+					return
+				}
+				seen = append(seen, mod.Path)
+			}))
+			Expect(err).To(MatchError(errTest))
+			Expect(seenErr).To(MatchError(errTest))
+			Expect(mods).To(Equal([]module.Module{modA}))
+			Expect(seen).To(Equal([]string{modA.Path}))
+		})
+	})
+})
@@ -4,21 +4,57 @@
 package module
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"sync"
 	"syscall"
 	"time"
 )
 
+// Module is a module as reported by 'go list -m -json'.
 type Module struct {
-	Path    string
-	Dir     string
-	Version string
-	Main    bool
+	Path       string
+	Version    string
+	Replace    *Module
+	Time       *time.Time
+	Main       bool
+	Indirect   bool
+	Dir        string
+	GoMod      string
+	GoVersion  string
+	Error      *Error
+	Deprecated string
+}
+
+// Error is an error loading a module.
+type Error struct {
+	Err string
+}
+
+func (e *Error) Error() string {
+	return e.Err
+}
+
+// ResolvedDir returns the directory backing the module.
+// For replaced modules without a directory, the directory of the replacement is returned.
+func (m *Module) ResolvedDir() string {
+	if m.Dir == "" && m.Replace != nil {
+		return m.Replace.ResolvedDir()
+	}
+	return m.Dir
+}
+
+// String returns the module path, followed by '@' and the version if present.
+func (m *Module) String() string {
+	if m.Version == "" {
+		return m.Path
+	}
+	return m.Path + "@" + m.Version
 }
 
 type Reader interface {
@@ -33,25 +69,68 @@ type ReadCloser interface {
 type readCloser struct {
 	mu sync.Mutex
 
-	cmd *exec.Cmd
-	dec *json.Decoder
+	cmd    *exec.Cmd
+	stdout *os.File
+	stderr *cappedBuffer
+	dec    *json.Decoder
+
+	gracePeriod time.Duration
+	killTimeout time.Duration
+
+	waitDone chan struct{}
+	waitErr  error
+	// terminated is set once the process has been signaled by the read closer itself.
+	terminated bool
+	// cancelErr is the context error if the process was terminated because the context was done.
+	cancelErr error
 
 	closed   bool
 	closeErr error
 }
 
+const (
+	// DefaultGracePeriod is the default time to wait for go list to exit after SIGTERM.
+	DefaultGracePeriod = 3 * time.Second
+
+	// DefaultKillTimeout is the default time to wait for go list to exit after SIGKILL.
+	DefaultKillTimeout = 1 * time.Second
+)
+
+// ErrCloseTimeout is returned by Close if the command did not exit in time.
+var ErrCloseTimeout = errors.New("error waiting for command to be completed")
+
 type OpenGoListOptions struct {
-	Dir     string
-	Command func() *exec.Cmd
+	// GoCommand configures the go command invocation.
+	GoCommand GoCommandOptions
+
+	Dir string
+	// WorkFile is passed as GOWORK to the command. Empty leaves GOWORK untouched.
+	WorkFile string
+	Command  func() *exec.Cmd
+	// GracePeriod is the time to wait for the command to exit after SIGTERM.
+	GracePeriod time.Duration
+	// KillTimeout is the time to wait for the command to exit after escalating to SIGKILL once
+	// the grace period expired. A negative value disables the escalation.
+	KillTimeout time.Duration
 }
 
 func (o *OpenGoListOptions) ApplyToOpenGoList(o2 *OpenGoListOptions) {
+	o.GoCommand.applyToGoCommand(&o2.GoCommand)
 	if o.Dir != "" {
 		o2.Dir = o.Dir
 	}
+	if o.WorkFile != "" {
+		o2.WorkFile = o.WorkFile
+	}
 	if o.Command != nil {
 		o2.Command = o.Command
 	}
+	if o.GracePeriod != 0 {
+		o2.GracePeriod = o.GracePeriod
+	}
+	if o.KillTimeout != 0 {
+		o2.KillTimeout = o.KillTimeout
+	}
 }
 
 func (o *OpenGoListOptions) ApplyOptions(opts []OpenGoListOption) {
@@ -70,100 +149,260 @@ func (d InDir) ApplyToOpenGoList(o *OpenGoListOptions) {
 	o.Dir = string(d)
 }
 
+type WithWorkFile string
+
+func (w WithWorkFile) ApplyToOpenGoList(o *OpenGoListOptions) {
+	o.WorkFile = string(w)
+}
+
+type WithGracePeriod time.Duration
+
+func (g WithGracePeriod) ApplyToOpenGoList(o *OpenGoListOptions) {
+	o.GracePeriod = time.Duration(g)
+}
+
+type WithKillTimeout time.Duration
+
+func (k WithKillTimeout) ApplyToOpenGoList(o *OpenGoListOptions) {
+	o.KillTimeout = time.Duration(k)
+}
+
 func setOpenGoListDefaults(o *OpenGoListOptions) {
 	if o.Dir == "" {
 		o.Dir = "."
 	}
 	if o.Command == nil {
+		goBinary := o.GoCommand.goBinary()
 		o.Command = func() *exec.Cmd {
-			return exec.Command("go", "list", "-m", "-json", "all")
+			return exec.Command(goBinary, "list", "-m", "-json", "all")
 		}
 	}
+	if o.GracePeriod == 0 {
+		o.GracePeriod = DefaultGracePeriod
+	}
+	if o.KillTimeout == 0 {
+		o.KillTimeout = DefaultKillTimeout
+	}
 }
 
 func OpenGoList(opts ...OpenGoListOption) (ReadCloser, error) {
+	return OpenGoListContext(context.Background(), opts...)
+}
+
+// OpenGoListContext is like OpenGoList but terminates the process group of the command
+// once ctx is done. Reads and Close then report the context error.
+func OpenGoListContext(ctx context.Context, opts ...OpenGoListOption) (ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	o := &OpenGoListOptions{}
 	o.ApplyOptions(opts)
 	setOpenGoListDefaults(o)
 
 	cmd := o.Command()
 	cmd.Dir = o.Dir
-	stdout, err := cmd.StdoutPipe()
+	if o.WorkFile != "" {
+		cmd.Env = append(cmdEnv(cmd), "GOWORK="+o.WorkFile)
+	}
+	o.GoCommand.setEnv(cmd)
+	setProcessGroup(cmd)
+
+	// Use a dedicated pipe instead of cmd.StdoutPipe, as the latter must not be waited on before
+	// all data has been read.
+	stdout, stdoutW, err := os.Pipe()
 	if err != nil {
 		return nil, err
 	}
+	cmd.Stdout = stdoutW
+
+	stderr := &cappedBuffer{max: maxStderrSize}
+	if cmd.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, stderr)
+	} else {
+		cmd.Stderr = stderr
+	}
 
-	if err := cmd.Start(); err != nil {
+	err = cmd.Start()
+	_ = stdoutW.Close()
+	if err != nil {
+		_ = stdout.Close()
 		return nil, err
 	}
 
-	dec := json.NewDecoder(stdout)
+	r := &readCloser{
+		cmd:         cmd,
+		stdout:      stdout,
+		stderr:      stderr,
+		dec:         json.NewDecoder(stdout),
+		gracePeriod: o.GracePeriod,
+		killTimeout: o.KillTimeout,
+		waitDone:    make(chan struct{}),
+	}
+	go func() {
+		defer close(r.waitDone)
+		r.waitErr = cmd.Wait()
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = r.terminate(ctx.Err())
+		case <-r.waitDone:
+		}
+	}()
+	return r, nil
+}
 
-	return &readCloser{
-		cmd: cmd,
-		dec: dec,
-	}, nil
+func cmdEnv(cmd *exec.Cmd) []string {
+	if cmd.Env != nil {
+		return cmd.Env
+	}
+	return os.Environ()
 }
 
 func (r *readCloser) Read(data []Module) (n int, err error) {
 	for i := 0; i < len(data); i++ {
-		mod := &data[i]
-		if err := r.dec.Decode(mod); err != nil {
+		if err := decodeModule(r.dec, &data[i]); err != nil {
+			if cancelErr := r.canceled(); cancelErr != nil {
+				return i, cancelErr
+			}
+			if exitErr := r.waitExitError(); exitErr != nil {
+				return i, exitErr
+			}
 			return i, err
 		}
 	}
 	return len(data), nil
 }
 
-func (r *readCloser) Close() error {
+// waitExitError waits up to the grace period for the command to exit after its output ended and
+// returns the resulting error, if any.
+func (r *readCloser) waitExitError() error {
+	timer := time.NewTimer(r.gracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-r.waitDone:
+	case <-timer.C:
+		return nil
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	return r.exitError()
+}
 
-	if r.closed {
-		return r.closeErr
+// exitError converts the result of waiting for the command into an error.
+// It has to be called with r.mu held, after the command finished.
+func (r *readCloser) exitError() error {
+	if r.waitErr == nil {
+		return nil
+	}
+	if r.terminated && r.cmd.ProcessState.ExitCode() == -1 {
+		// The command was stopped by our signal, its exit status does not matter.
+		return nil
 	}
 
-	defer func() { r.closed = true }()
+	var exitErr *exec.ExitError
+	if errors.As(r.waitErr, &exitErr) {
+		return newGoListError(exitErr.ExitCode(), r.stderr.String(), exitErr)
+	}
+	return fmt.Errorf("command failed: %w", r.waitErr)
+}
 
-	waitDone := make(chan struct{})
-	go func() {
-		defer close(waitDone)
-		_ = r.cmd.Wait()
-	}()
+func (r *readCloser) canceled() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cancelErr
+}
 
-	_ = r.cmd.Process.Signal(syscall.SIGTERM)
+// terminate sends SIGTERM to the process group of the command, escalating to SIGKILL if the
+// command does not exit within the grace period. cause is recorded as cancellation error, if set.
+func (r *readCloser) terminate(cause error) error {
+	select {
+	case <-r.waitDone:
+		return nil
+	default:
+	}
 
-	timer := time.NewTimer(3 * time.Second)
-	defer timer.Stop()
+	r.mu.Lock()
+	r.terminated = true
+	if cause != nil && r.cancelErr == nil {
+		r.cancelErr = cause
+	}
+	r.mu.Unlock()
+
+	_ = signalProcessGroup(r.cmd, syscall.SIGTERM)
+
+	grace := time.NewTimer(r.gracePeriod)
+	defer grace.Stop()
 
 	select {
-	case <-timer.C:
-		r.closeErr = fmt.Errorf("error waiting for command to be completed")
-	case <-waitDone:
+	case <-r.waitDone:
+		return nil
+	case <-grace.C:
+	}
+
+	if r.killTimeout < 0 {
+		return ErrCloseTimeout
+	}
+
+	_ = signalProcessGroup(r.cmd, syscall.SIGKILL)
+
+	kill := time.NewTimer(r.killTimeout)
+	defer kill.Stop()
+
+	select {
+	case <-r.waitDone:
+		return nil
+	case <-kill.C:
+		return ErrCloseTimeout
+	}
+}
+
+// Close terminates the command if it is still running and waits for it.
+// The returned error wraps ErrCloseTimeout if the command did not exit in time,
+// the context error if the context was done and is a *GoListError if the command
+// exited with a non-zero status on its own.
+func (r *readCloser) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		defer r.mu.Unlock()
+		return r.closeErr
+	}
+	r.mu.Unlock()
+
+	termErr := r.terminate(nil)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return r.closeErr
+	}
+	r.closed = true
+	_ = r.stdout.Close()
+
+	switch {
+	case termErr != nil:
+		r.closeErr = termErr
+	case r.cancelErr != nil:
+		r.closeErr = fmt.Errorf("command canceled: %w", r.cancelErr)
+	default:
+		r.closeErr = r.exitError()
 	}
 	return r.closeErr
 }
 
 func ReadAll(r Reader) ([]Module, error) {
-	b := make([]Module, 0, 128)
-	for {
-		if len(b) == cap(b) {
-			// Add more capacity (let append pick how much).
-			b = append(b, Module{})[:len(b)]
-		}
-		n, err := r.Read(b[len(b):cap(b)])
-		b = b[:len(b)+n]
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				err = nil
-			}
-			return b, err
-		}
-	}
+	return Collect(All(r))
 }
 
 func ReadAllGoListModules(opts ...OpenGoListOption) ([]Module, error) {
-	rc, err := OpenGoList(opts...)
+	return ReadAllGoListModulesContext(context.Background(), opts...)
+}
+
+func ReadAllGoListModulesContext(ctx context.Context, opts ...OpenGoListOption) ([]Module, error) {
+	rc, err := OpenGoListContext(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
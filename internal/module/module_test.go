@@ -4,9 +4,15 @@
 package module_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/ironcore-dev/vgopath/internal/module"
 	"github.com/ironcore-dev/vgopath/internal/testdata"
@@ -27,15 +33,35 @@ var _ = Describe("Internal", func() {
 		It("should error on the first read if modules are not present", func() {
 			rc, err := module.OpenGoList(module.InDir(GinkgoT().TempDir()))
 			Expect(err).NotTo(HaveOccurred())
-			DeferCleanup(rc.Close)
 
 			_, err = rc.Read(make([]module.Module, 2))
 			Expect(err).To(HaveOccurred())
+
+			var exitErr *exec.ExitError
+			Expect(errors.As(rc.Close(), &exitErr)).To(BeTrue(), "close should report the non-zero exit")
+		})
+
+		It("should report the exit code and diagnostics of a failing go list", func() {
+			rc, err := module.OpenGoList(module.InDir(GinkgoT().TempDir()))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = rc.Read(make([]module.Module, 2))
+			var goListErr *module.GoListError
+			Expect(errors.As(err, &goListErr)).To(BeTrue())
+			Expect(goListErr.ExitCode).To(Equal(1))
+			Expect(goListErr.Stderr).To(ContainSubstring("go.mod file not found"))
+			Expect(goListErr.Diagnostics).NotTo(BeEmpty())
+			Expect(goListErr.Diagnostics[0].Message).To(ContainSubstring("go.mod file not found"))
+
+			Expect(rc.Close()).To(MatchError(goListErr))
 		})
 
 		It("should return the modules and return io.EOF when done", func() {
-			By("opening the ginkgo temp dir")
-			rc, err := module.OpenGoList(module.InDir(filepath.Join("..", "testdata", "gocat")))
+			dir := GinkgoT().TempDir()
+			Expect(writeFiles(dir, map[string]string{"go.mod": "module example.org/single\n"})).To(Succeed())
+			GinkgoT().Setenv("GOWORK", "off")
+
+			rc, err := module.OpenGoList(module.InDir(dir))
 			Expect(err).NotTo(HaveOccurred())
 			DeferCleanup(rc.Close)
 
@@ -45,26 +71,140 @@ var _ = Describe("Internal", func() {
 			Expect(n).To(Equal(1))
 		})
 
-		It("should parse the command data as JSON stream", func() {
-			cmd := func() *exec.Cmd {
-				return exec.Command(gocatExecutable, filepath.Join("..", "testdata", "modules.json.stream"))
+		catCommand := func(name string) func() *exec.Cmd {
+			return func() *exec.Cmd {
+				return exec.Command("sh", "-c", `cat "$1"`, "sh", filepath.Join("..", "testdata", name))
 			}
-			rc, err := module.OpenGoList(&module.OpenGoListOptions{Command: cmd})
+		}
+
+		It("should parse the command data as JSON stream", func() {
+			rc, err := module.OpenGoList(&module.OpenGoListOptions{Command: catCommand("modules.json.stream")})
 			Expect(err).NotTo(HaveOccurred())
-			DeferCleanup(rc.Close)
 
 			modules := make([]module.Module, 4)
 			n, err := rc.Read(modules)
 			Expect(err).To(MatchError(io.EOF))
 			Expect(n).To(Equal(3))
 			Expect(modules[:3]).To(Equal(testdata.Modules))
+
+			Expect(rc.Close()).To(Succeed())
 		})
 
 		It("should properly chunk the command data JSON stream", func() {
+			rc, err := module.OpenGoList(&module.OpenGoListOptions{Command: catCommand("modules.json.stream")})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(rc.Close)
+
+			modules := make([]module.Module, 4)
+			n, err := rc.Read(modules[:2])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(Equal(2))
+
+			n, err = rc.Read(modules[2:4])
+			Expect(err).To(MatchError(io.EOF))
+			Expect(n).To(Equal(1))
+
+			Expect(modules[:3]).To(Equal(testdata.Modules))
+		})
+
+		It("should decode the full module record from the command", func() {
+			mods, err := module.ReadAllGoListModules(&module.OpenGoListOptions{Command: catCommand("modules-full.json.stream")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mods).To(Equal(testdata.FullModules))
+		})
+
+		It("should read command output spanning several batches", func() {
 			cmd := func() *exec.Cmd {
-				return exec.Command(gocatExecutable, filepath.Join("..", "testdata", "modules.json.stream"))
+				return exec.Command("sh", "-c", `i=0; while [ $i -lt 100 ]; do echo "{\"Path\": \"example.org/m$i\"}"; i=$((i+1)); done`)
 			}
-			rc, err := module.OpenGoList(&module.OpenGoListOptions{Command: cmd})
+			mods, err := module.ReadAllGoListModules(&module.OpenGoListOptions{Command: cmd})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mods).To(HaveLen(100))
+			for i, mod := range mods {
+				Expect(mod.Path).To(Equal(fmt.Sprintf("example.org/m%d", i)))
+			}
+		})
+
+		It("should close the command before its output was read", func() {
+			rc, err := module.OpenGoList(&module.OpenGoListOptions{Command: catCommand("modules.json.stream")})
+			Expect(err).NotTo(HaveOccurred())
+
+			n, err := rc.Read(make([]module.Module, 1))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(Equal(1))
+
+			Expect(rc.Close()).To(Succeed())
+		})
+
+		It("should report a timeout if the command does not exit within the grace period", func() {
+			cmd := func() *exec.Cmd {
+				// The ignored signal is inherited by sleep, so the process group exits after a second.
+				return exec.Command("sh", "-c", `trap "" TERM; echo '{"Path": "ready"}'; sleep 1`)
+			}
+			rc, err := module.OpenGoList(
+				&module.OpenGoListOptions{Command: cmd},
+				module.WithGracePeriod(100*time.Millisecond),
+				module.WithKillTimeout(-1),
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("waiting for the signal handler to be set up")
+			_, err = rc.Read(make([]module.Module, 1))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(rc.Close()).To(MatchError(module.ErrCloseTimeout))
+		})
+
+		It("should kill the command if it ignores SIGTERM", func() {
+			cmd := func() *exec.Cmd {
+				return exec.Command("sh", "-c", `trap "" TERM; echo '{"Path": "ready"}'; while true; do sleep 0.1; done`)
+			}
+			rc, err := module.OpenGoList(&module.OpenGoListOptions{Command: cmd}, module.WithGracePeriod(100*time.Millisecond))
+			Expect(err).NotTo(HaveOccurred())
+
+			By("waiting for the signal handler to be set up")
+			_, err = rc.Read(make([]module.Module, 1))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(rc.Close()).To(Succeed())
+		})
+
+		It("should terminate the command once the context is canceled", func(ctx SpecContext) {
+			cmd := func() *exec.Cmd {
+				// Start a child process that keeps the pipe open to verify the whole process group is terminated.
+				return exec.Command("sh", "-c", `sleep 60 & wait`)
+			}
+			listCtx, cancel := context.WithCancel(ctx)
+			rc, err := module.OpenGoListContext(listCtx, &module.OpenGoListOptions{Command: cmd})
+			Expect(err).NotTo(HaveOccurred())
+
+			readErr := make(chan error, 1)
+			go func() {
+				_, err := rc.Read(make([]module.Module, 1))
+				readErr <- err
+			}()
+
+			cancel()
+			Eventually(ctx, readErr).Should(Receive(MatchError(context.Canceled)))
+			Expect(rc.Close()).To(MatchError(context.Canceled))
+		}, SpecTimeout(10*time.Second))
+	})
+
+	Describe("OpenFile", func() {
+		It("should parse the file as JSON stream", func() {
+			rc, err := module.OpenFile(filepath.Join("..", "testdata", "modules.json.stream"))
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(rc.Close)
+
+			modules := make([]module.Module, 4)
+			n, err := rc.Read(modules)
+			Expect(err).To(MatchError(io.EOF))
+			Expect(n).To(Equal(3))
+			Expect(modules[:3]).To(Equal(testdata.Modules))
+		})
+
+		It("should properly chunk the JSON stream", func() {
+			rc, err := module.OpenFile(filepath.Join("..", "testdata", "modules.json.stream"))
 			Expect(err).NotTo(HaveOccurred())
 			DeferCleanup(rc.Close)
 
@@ -79,5 +219,44 @@ var _ = Describe("Internal", func() {
 
 			Expect(modules[:3]).To(Equal(testdata.Modules))
 		})
+
+		It("should decode the full module record", func() {
+			mods, err := module.ReadAllFileModules(filepath.Join("..", "testdata", "modules-full.json.stream"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mods).To(Equal(testdata.FullModules))
+		})
+
+		It("should read from stdin", func() {
+			stdin, err := os.Open(filepath.Join("..", "testdata", "modules.json.stream"))
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(stdin.Close)
+
+			origStdin := os.Stdin
+			os.Stdin = stdin
+			DeferCleanup(func() { os.Stdin = origStdin })
+
+			mods, err := module.ReadAllFileModules(module.Stdin)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mods).To(Equal(testdata.Modules))
+		})
+
+		It("should error on malformed input", func() {
+			_, err := module.ReadAll(module.NewJSONReader(strings.NewReader(`{"Path": `)))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Module", func() {
+		It("should resolve the directory of a replaced module", func() {
+			mod := module.Module{
+				Path:    "example.org/b",
+				Replace: &module.Module{Path: "../b", Dir: "/tmp/b"},
+			}
+			Expect(mod.ResolvedDir()).To(Equal("/tmp/b"))
+		})
+
+		It("should prefer the module directory", func() {
+			Expect(testdata.FullModuleB.ResolvedDir()).To(Equal(testdata.FullModuleB.Dir))
+		})
 	})
 })
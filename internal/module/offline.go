@@ -0,0 +1,598 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	xmodule "golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	// GoModFileName is the name of the go module file.
+	GoModFileName = "go.mod"
+
+	// prunedGoVersion is the go version starting from which module graphs are pruned.
+	prunedGoVersion = "1.17"
+)
+
+type OpenOfflineOptions struct {
+	Dir string
+	// WorkFile is the go.work file to use. Empty detects the workspace, GoWorkOff disables it.
+	WorkFile string
+	// ModCache is the module cache directory. Empty defaults to GOMODCACHE.
+	ModCache string
+}
+
+func (o *OpenOfflineOptions) ApplyToOpenOffline(o2 *OpenOfflineOptions) {
+	if o.Dir != "" {
+		o2.Dir = o.Dir
+	}
+	if o.WorkFile != "" {
+		o2.WorkFile = o.WorkFile
+	}
+	if o.ModCache != "" {
+		o2.ModCache = o.ModCache
+	}
+}
+
+func (o *OpenOfflineOptions) ApplyOptions(opts []OpenOfflineOption) {
+	for _, opt := range opts {
+		opt.ApplyToOpenOffline(o)
+	}
+}
+
+type OpenOfflineOption interface {
+	ApplyToOpenOffline(o *OpenOfflineOptions)
+}
+
+func (d InDir) ApplyToOpenOffline(o *OpenOfflineOptions) {
+	o.Dir = string(d)
+}
+
+func (w WithWorkFile) ApplyToOpenOffline(o *OpenOfflineOptions) {
+	o.WorkFile = string(w)
+}
+
+type WithModCache string
+
+func (c WithModCache) ApplyToOpenOffline(o *OpenOfflineOptions) {
+	o.ModCache = string(c)
+}
+
+func setOpenOfflineDefaults(o *OpenOfflineOptions) {
+	if o.Dir == "" {
+		o.Dir = "."
+	}
+	if o.ModCache == "" {
+		o.ModCache = DefaultModCache()
+	}
+}
+
+// DefaultModCache returns the module cache directory the go command would use.
+func DefaultModCache() string {
+	if modCache := os.Getenv("GOMODCACHE"); modCache != "" {
+		return modCache
+	}
+	gopaths := filepath.SplitList(build.Default.GOPATH)
+	if len(gopaths) == 0 {
+		return ""
+	}
+	return filepath.Join(gopaths[0], "pkg", "mod")
+}
+
+// OpenOffline resolves the module graph without invoking the go command.
+// It parses the go.mod (and go.work) files of the main modules and applies minimal version selection
+// over the go.mod files present in the module cache. Modules are reported in the same order as
+// 'go list -m all' reports them.
+//
+// Unlike the go command, the module graph of a workspace is loaded only once: requirements of
+// pruned modules that are only reached because another workspace module selects a higher version
+// are not reloaded, which may select lower versions than 'go list -m all' in rare cases.
+func OpenOffline(opts ...OpenOfflineOption) (Reader, error) {
+	o := &OpenOfflineOptions{}
+	o.ApplyOptions(opts)
+	setOpenOfflineDefaults(o)
+
+	workFile := o.WorkFile
+	switch workFile {
+	case "":
+		var err error
+		workFile, err = FindGoWork(o.Dir)
+		if err != nil {
+			return nil, err
+		}
+	case GoWorkOff:
+		workFile = ""
+	}
+
+	r := &offlineResolver{
+		modCache: o.ModCache,
+		replace:  make(map[xmodule.Version]replacement),
+		selected: make(map[string]string),
+		mains:    make(map[string]*offlineMain),
+		loaded:   make(map[xmodule.Version]*modfile.File),
+		exclude:  make(map[xmodule.Version]bool),
+		visited:  make(map[visitKey]bool),
+	}
+
+	if workFile != "" {
+		if err := r.loadWorkspace(workFile); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := r.loadSingleModule(o.Dir); err != nil {
+			return nil, err
+		}
+	}
+
+	mods, err := r.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return &sliceReader{mods: mods}, nil
+}
+
+func ReadAllOfflineModules(opts ...OpenOfflineOption) ([]Module, error) {
+	r, err := OpenOffline(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return ReadAll(r)
+}
+
+type replacement struct {
+	// dir is the directory new is relative to.
+	dir string
+	new xmodule.Version
+}
+
+func (r replacement) isLocal() bool {
+	return r.new.Version == ""
+}
+
+func (r replacement) localDir() string {
+	if filepath.IsAbs(r.new.Path) {
+		return filepath.Clean(r.new.Path)
+	}
+	return filepath.Join(r.dir, r.new.Path)
+}
+
+type offlineMain struct {
+	dir  string
+	file *modfile.File
+}
+
+type offlineResolver struct {
+	modCache string
+	// pruned reports whether the module graph is pruned. This is the case for workspaces and
+	// main modules at go 1.17 or higher.
+	pruned bool
+
+	// mainPaths keeps the main modules in declaration order.
+	mainPaths []string
+	mains     map[string]*offlineMain
+	replace   map[xmodule.Version]replacement
+	// exclude contains the module versions excluded by any of the main modules.
+	exclude map[xmodule.Version]bool
+
+	selected map[string]string
+	loaded   map[xmodule.Version]*modfile.File
+	visited  map[visitKey]bool
+}
+
+// visitKey identifies a module version loaded in a pruned or unpruned context.
+type visitKey struct {
+	mod    xmodule.Version
+	pruned bool
+}
+
+// parseModFile parses the given go.mod file. Dependency go.mod files are parsed leniently,
+// ignoring their replace and exclude directives, the same way the go command does.
+func parseModFile(filename string, main bool) (*modfile.File, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if main {
+		return modfile.Parse(filename, data, nil)
+	}
+	return modfile.ParseLax(filename, data, nil)
+}
+
+var errGoModNotFound = errors.New(GoModFileName + " file not found in current directory or any parent directory")
+
+// FindGoMod returns the go.mod file of the module containing dir.
+func FindGoMod(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		filename := filepath.Join(dir, GoModFileName)
+		if stat, err := os.Stat(filename); err == nil && !stat.IsDir() {
+			return filename, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errGoModNotFound
+		}
+		dir = parent
+	}
+}
+
+func (r *offlineResolver) addMain(dir string) error {
+	goModFile := filepath.Join(dir, GoModFileName)
+	file, err := parseModFile(goModFile, true)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", goModFile, err)
+	}
+	if file.Module == nil {
+		return fmt.Errorf("%s does not declare a module path", goModFile)
+	}
+
+	path := file.Module.Mod.Path
+	if existing, ok := r.mains[path]; ok {
+		return fmt.Errorf("module %s appears multiple times in workspace: %s and %s", path, existing.dir, dir)
+	}
+	r.mains[path] = &offlineMain{dir: dir, file: file}
+	r.mainPaths = append(r.mainPaths, path)
+	for _, exclude := range file.Exclude {
+		r.exclude[exclude.Mod] = true
+	}
+	return nil
+}
+
+func (r *offlineResolver) addReplaces(dir string, replaces []*modfile.Replace, override bool) {
+	for _, rep := range replaces {
+		if _, ok := r.replace[rep.Old]; ok && !override {
+			continue
+		}
+		r.replace[rep.Old] = replacement{dir: dir, new: rep.New}
+	}
+}
+
+func (r *offlineResolver) loadSingleModule(dir string) error {
+	goModFile, err := FindGoMod(dir)
+	if err != nil {
+		return err
+	}
+
+	modDir := filepath.Dir(goModFile)
+	if err := r.addMain(modDir); err != nil {
+		return err
+	}
+	main := r.mains[r.mainPaths[0]]
+	r.pruned = isPruned(main.file)
+	r.addReplaces(modDir, main.file.Replace, true)
+	return nil
+}
+
+func (r *offlineResolver) loadWorkspace(workFile string) error {
+	data, err := os.ReadFile(workFile)
+	if err != nil {
+		return err
+	}
+
+	file, err := modfile.ParseWork(workFile, data, nil)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", workFile, err)
+	}
+
+	r.pruned = true
+	workDir := filepath.Dir(workFile)
+	for _, use := range file.Use {
+		dir := use.Path
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(workDir, dir)
+		}
+		if err := r.addMain(dir); err != nil {
+			return err
+		}
+	}
+
+	// Replacements of the workspace take precedence over the ones of the individual modules.
+	r.addReplaces(workDir, file.Replace, true)
+	for _, path := range r.mainPaths {
+		main := r.mains[path]
+		r.addReplaces(main.dir, main.file.Replace, false)
+	}
+	return nil
+}
+
+func (r *offlineResolver) replacementFor(mod xmodule.Version) (replacement, bool) {
+	if rep, ok := r.replace[mod]; ok {
+		return rep, true
+	}
+	rep, ok := r.replace[xmodule.Version{Path: mod.Path}]
+	return rep, ok
+}
+
+func (r *offlineResolver) cacheDownloadFile(mod xmodule.Version, suffix string) (string, error) {
+	escPath, err := xmodule.EscapePath(mod.Path)
+	if err != nil {
+		return "", err
+	}
+	escVersion, err := xmodule.EscapeVersion(mod.Version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(r.modCache, "cache", "download", escPath, "@v", escVersion+suffix), nil
+}
+
+func (r *offlineResolver) cacheDir(mod xmodule.Version) (string, error) {
+	escPath, err := xmodule.EscapePath(mod.Path)
+	if err != nil {
+		return "", err
+	}
+	escVersion, err := xmodule.EscapeVersion(mod.Version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(r.modCache, escPath+"@"+escVersion), nil
+}
+
+// goModFile returns the go.mod file that defines the requirements of the given module version.
+func (r *offlineResolver) goModFile(mod xmodule.Version) (string, error) {
+	if main, ok := r.mains[mod.Path]; ok {
+		return filepath.Join(main.dir, GoModFileName), nil
+	}
+	if rep, ok := r.replacementFor(mod); ok {
+		if rep.isLocal() {
+			return filepath.Join(rep.localDir(), GoModFileName), nil
+		}
+		mod = rep.new
+	}
+	return r.cacheDownloadFile(mod, ".mod")
+}
+
+func (r *offlineResolver) load(mod xmodule.Version) (*modfile.File, error) {
+	if file, ok := r.loaded[mod]; ok {
+		return file, nil
+	}
+
+	var file *modfile.File
+	if main, ok := r.mains[mod.Path]; ok {
+		file = main.file
+	} else {
+		filename, err := r.goModFile(mod)
+		if err != nil {
+			return nil, err
+		}
+
+		file, err = parseModFile(filename, false)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("%s: go.mod not found in module cache, run 'go mod download'", mod)
+			}
+			return nil, fmt.Errorf("%s: error parsing go.mod: %w", mod, err)
+		}
+	}
+
+	r.loaded[mod] = file
+	return file, nil
+}
+
+func isPruned(file *modfile.File) bool {
+	return file.Go != nil && semver.Compare("v"+file.Go.Version, "v"+prunedGoVersion) >= 0
+}
+
+func (r *offlineResolver) require(mod xmodule.Version) {
+	if _, ok := r.mains[mod.Path]; ok {
+		return
+	}
+	if current, ok := r.selected[mod.Path]; !ok || semver.Compare(mod.Version, current) > 0 {
+		r.selected[mod.Path] = mod.Version
+	}
+}
+
+// visit adds the requirements of mod to the graph, the same way the go command loads the module graph.
+// Requirements on excluded versions are dropped. A module loaded in a pruned context at go 1.17 or higher
+// only contributes its immediate requirements. All other modules have their requirements visited, and once
+// a module is loaded in an unpruned context, so is everything reachable from it, regardless of the go
+// version of the modules below.
+func (r *offlineResolver) visit(mod xmodule.Version, pruned bool) error {
+	key := visitKey{mod: mod, pruned: pruned}
+	if r.visited[key] {
+		return nil
+	}
+	r.visited[key] = true
+
+	file, err := r.load(mod)
+	if err != nil {
+		return err
+	}
+
+	_, isMain := r.mains[mod.Path]
+	next := pruned && isPruned(file)
+	if isMain {
+		next = r.pruned
+	}
+	expand := isMain || !next
+	for _, req := range file.Require {
+		if r.exclude[req.Mod] {
+			continue
+		}
+		r.require(req.Mod)
+		if !expand {
+			continue
+		}
+		if _, ok := r.mains[req.Mod.Path]; ok {
+			continue
+		}
+		if err := r.visit(req.Mod, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *offlineResolver) resolve() ([]Module, error) {
+	direct := make(map[string]bool)
+	for _, path := range r.mainPaths {
+		main := r.mains[path]
+		for _, req := range main.file.Require {
+			if !req.Indirect {
+				direct[req.Mod.Path] = true
+			}
+		}
+
+		if err := r.visit(xmodule.Version{Path: path}, r.pruned); err != nil {
+			return nil, err
+		}
+	}
+
+	res := make([]Module, 0, len(r.mainPaths)+len(r.selected))
+	for _, path := range r.mainPaths {
+		main := r.mains[path]
+		mod := Module{
+			Path:  path,
+			Main:  true,
+			Dir:   main.dir,
+			GoMod: filepath.Join(main.dir, GoModFileName),
+		}
+		if main.file.Go != nil {
+			mod.GoVersion = main.file.Go.Version
+		}
+		res = append(res, mod)
+	}
+
+	paths := make([]string, 0, len(r.selected))
+	for path := range r.selected {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	for _, path := range paths {
+		mod, err := r.module(xmodule.Version{Path: path, Version: r.selected[path]})
+		if err != nil {
+			return nil, err
+		}
+		mod.Indirect = !direct[path]
+		res = append(res, mod)
+	}
+	return res, nil
+}
+
+func (r *offlineResolver) module(v xmodule.Version) (Module, error) {
+	mod := Module{
+		Path:    v.Path,
+		Version: v.Version,
+	}
+
+	rep, ok := r.replacementFor(v)
+	if !ok {
+		if err := r.fillFromModCache(&mod); err != nil {
+			return Module{}, err
+		}
+		return mod, nil
+	}
+
+	if rep.isLocal() {
+		mod.Replace = &Module{
+			Path: rep.new.Path,
+			Dir:  rep.localDir(),
+		}
+		mod.Replace.GoMod = filepath.Join(mod.Replace.Dir, GoModFileName)
+		if !dirExists(mod.Replace.Dir) {
+			mod.Replace.Dir = ""
+		}
+	} else {
+		mod.Replace = &Module{
+			Path:    rep.new.Path,
+			Version: rep.new.Version,
+		}
+		if err := r.fillFromModCache(mod.Replace); err != nil {
+			return Module{}, err
+		}
+	}
+
+	mod.Dir = mod.Replace.Dir
+	mod.GoMod = mod.Replace.GoMod
+	mod.GoVersion = r.goVersion(v)
+	mod.Replace.GoVersion = mod.GoVersion
+	return mod, nil
+}
+
+func (r *offlineResolver) fillFromModCache(mod *Module) error {
+	v := xmodule.Version{Path: mod.Path, Version: mod.Version}
+
+	goMod, err := r.cacheDownloadFile(v, ".mod")
+	if err != nil {
+		return err
+	}
+	mod.GoMod = goMod
+
+	dir, err := r.cacheDir(v)
+	if err != nil {
+		return err
+	}
+	if dirExists(dir) {
+		mod.Dir = dir
+	}
+
+	mod.GoVersion = r.goVersion(v)
+	mod.Time = r.time(v)
+	return nil
+}
+
+// time returns the version time recorded in the module cache, if available.
+func (r *offlineResolver) time(v xmodule.Version) *time.Time {
+	filename, err := r.cacheDownloadFile(v, ".info")
+	if err != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+
+	var info struct {
+		Time *time.Time
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil
+	}
+	return info.Time
+}
+
+// goVersion returns the go version declared by the go.mod file of the given module version, if available.
+func (r *offlineResolver) goVersion(v xmodule.Version) string {
+	file, err := r.load(v)
+	if err != nil || file.Go == nil {
+		return ""
+	}
+	return file.Go.Version
+}
+
+func dirExists(dir string) bool {
+	stat, err := os.Stat(dir)
+	return err == nil && stat.IsDir()
+}
+
+type sliceReader struct {
+	mods []Module
+}
+
+func (r *sliceReader) Read(data []Module) (int, error) {
+	if len(r.mods) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(data, r.mods)
+	r.mods = r.mods[n:]
+	return n, nil
+}
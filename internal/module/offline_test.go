@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ironcore-dev/vgopath/internal/module"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Offline", func() {
+	var (
+		modCache string
+		mainDir  string
+	)
+	BeforeEach(func() {
+		modCache = GinkgoT().TempDir()
+		mainDir = GinkgoT().TempDir()
+		GinkgoT().Setenv("GOWORK", "off")
+
+		Expect(writeFiles(modCache, map[string]string{
+			// example.org/Upper is stored case-encoded in the module cache.
+			"cache/download/example.org/!upper/@v/v1.0.0.mod":  "module example.org/Upper\n\ngo 1.17\n\nrequire example.org/c v1.1.0\n",
+			"cache/download/example.org/!upper/@v/v1.0.0.info": `{"Version":"v1.0.0","Time":"2023-01-02T03:04:05Z"}`,
+			"example.org/!upper@v1.0.0/upper.go":               "package upper\n",
+			"cache/download/example.org/c/@v/v1.0.0.mod":       "module example.org/c\n\ngo 1.17\n",
+			"cache/download/example.org/c/@v/v1.1.0.mod":       "module example.org/c\n\ngo 1.17\n\nrequire example.org/d v1.0.0\n",
+			"example.org/c@v1.1.0/c.go":                        "package c\n",
+			// example.org/d is only required by a pruned dependency of a pruned dependency and thus is
+			// not part of the module graph.
+			"cache/download/example.org/legacy/@v/v1.0.0.mod":     "module example.org/legacy\n\nrequire example.org/transitive v1.0.0\n",
+			"cache/download/example.org/transitive/@v/v1.0.0.mod": "module example.org/transitive\n",
+		})).To(Succeed())
+	})
+
+	It("should select the maximum required version and resolve the module cache directories", func() {
+		Expect(writeFiles(mainDir, map[string]string{
+			"go.mod": `module example.org/main
+
+go 1.22
+
+require (
+	example.org/Upper v1.0.0
+	example.org/c v1.0.0 // indirect
+)
+`,
+		})).To(Succeed())
+
+		upperTime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+		mods, err := module.ReadAllOfflineModules(module.InDir(mainDir), module.WithModCache(modCache))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mods).To(Equal([]module.Module{
+			{
+				Path:      "example.org/main",
+				Main:      true,
+				Dir:       mainDir,
+				GoMod:     filepath.Join(mainDir, "go.mod"),
+				GoVersion: "1.22",
+			},
+			{
+				Path:      "example.org/Upper",
+				Version:   "v1.0.0",
+				Dir:       filepath.Join(modCache, "example.org", "!upper@v1.0.0"),
+				GoMod:     filepath.Join(modCache, "cache", "download", "example.org", "!upper", "@v", "v1.0.0.mod"),
+				GoVersion: "1.17",
+				Time:      &upperTime,
+			},
+			{
+				Path:      "example.org/c",
+				Version:   "v1.1.0",
+				Indirect:  true,
+				Dir:       filepath.Join(modCache, "example.org", "c@v1.1.0"),
+				GoMod:     filepath.Join(modCache, "cache", "download", "example.org", "c", "@v", "v1.1.0.mod"),
+				GoVersion: "1.17",
+			},
+		}))
+	})
+
+	It("should include transitive requirements of unpruned modules", func() {
+		Expect(writeFiles(mainDir, map[string]string{
+			"go.mod": "module example.org/main\n\ngo 1.22\n\nrequire example.org/legacy v1.0.0\n",
+		})).To(Succeed())
+
+		mods, err := module.ReadAllOfflineModules(module.InDir(mainDir), module.WithModCache(modCache))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(modulePaths(mods)).To(Equal([]string{"example.org/main", "example.org/legacy", "example.org/transitive"}))
+	})
+
+	It("should load the module graph and apply excludes like go list", func() {
+		mod := func(path, goVersion string, requires ...string) string {
+			s := "module " + path + "\n"
+			if goVersion != "" {
+				s += "\ngo " + goVersion + "\n"
+			}
+			for _, req := range requires {
+				s += "\nrequire " + req + "\n"
+			}
+			return s
+		}
+		files := make(map[string]string)
+		for path, goMod := range map[string]string{
+			// p1 and p2 are pruned, so p3 is not part of the module graph.
+			"p1@v1.0.0": mod("example.org/p1", "1.17", "example.org/p2 v1.0.0"),
+			"p2@v1.0.0": mod("example.org/p2", "1.17", "example.org/p3 v1.0.0"),
+			// u1 is unpruned, so everything below it is loaded unpruned as well, including p6.
+			"u1@v1.0.0": mod("example.org/u1", "", "example.org/p4 v1.0.0", "example.org/x v1.0.0"),
+			"p4@v1.0.0": mod("example.org/p4", "1.17", "example.org/p5 v1.0.0"),
+			"p5@v1.0.0": mod("example.org/p5", "1.17", "example.org/p6 v1.0.0", "example.org/x v1.1.0"),
+			"p6@v1.0.0": mod("example.org/p6", "1.17"),
+			"x@v1.0.0":  mod("example.org/x", "1.17"),
+			"x@v1.1.0":  mod("example.org/x", "1.17"),
+		} {
+			name, version, _ := strings.Cut(path, "@")
+			files["cache/download/example.org/"+name+"/@v/"+version+".mod"] = goMod
+			files["cache/download/example.org/"+name+"/@v/"+version+".info"] = `{"Version":"` + version + `"}`
+		}
+		Expect(writeFiles(modCache, files)).To(Succeed())
+		Expect(writeFiles(mainDir, map[string]string{
+			"go.mod": `module example.org/main
+
+go 1.22
+
+require (
+	example.org/p1 v1.0.0
+	example.org/u1 v1.0.0
+)
+
+exclude example.org/x v1.1.0
+`,
+		})).To(Succeed())
+
+		cmd := exec.Command("go", "list", "-m", "-f", "{{.Path}} {{.Version}}", "all")
+		cmd.Dir = mainDir
+		cmd.Env = append(os.Environ(),
+			"GOMODCACHE="+modCache,
+			"GOFLAGS=-mod=mod",
+			"GOPROXY=off",
+			"GOSUMDB=off",
+			"GOTOOLCHAIN=local",
+		)
+		out, err := cmd.Output()
+		Expect(err).NotTo(HaveOccurred())
+
+		mods, err := module.ReadAllOfflineModules(module.InDir(mainDir), module.WithModCache(modCache))
+		Expect(err).NotTo(HaveOccurred())
+		lines := make([]string, 0, len(mods))
+		for _, mod := range mods {
+			lines = append(lines, strings.TrimSpace(mod.Path+" "+mod.Version))
+		}
+		var goListLines []string
+		for line := range strings.Lines(string(out)) {
+			goListLines = append(goListLines, strings.TrimSpace(line))
+		}
+		Expect(lines).To(Equal(goListLines))
+		Expect(lines).To(ContainElements("example.org/p6 v1.0.0", "example.org/x v1.0.0"))
+	})
+
+	It("should apply local replacements", func() {
+		Expect(writeFiles(mainDir, map[string]string{
+			"go.mod":     "module example.org/main\n\ngo 1.22\n\nrequire example.org/e v1.0.0\n\nreplace example.org/e => ./e\n",
+			"e/go.mod":   "module example.org/e\n\ngo 1.22\n\nrequire example.org/c v1.0.0\n",
+			"sub/dir.go": "package sub\n",
+		})).To(Succeed())
+
+		mods, err := module.ReadAllOfflineModules(module.InDir(filepath.Join(mainDir, "sub")), module.WithModCache(modCache))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(modulePaths(mods)).To(Equal([]string{"example.org/main", "example.org/c", "example.org/e"}))
+		Expect(mods[2].Dir).To(Equal(filepath.Join(mainDir, "e")))
+		Expect(mods[2].Replace).To(Equal(&module.Module{
+			Path:      "./e",
+			Dir:       filepath.Join(mainDir, "e"),
+			GoMod:     filepath.Join(mainDir, "e", "go.mod"),
+			GoVersion: "1.22",
+		}))
+	})
+
+	It("should error if a go.mod file is missing from the module cache", func() {
+		Expect(writeFiles(mainDir, map[string]string{
+			"go.mod": "module example.org/main\n\ngo 1.22\n\nrequire example.org/missing v1.0.0\n",
+		})).To(Succeed())
+
+		_, err := module.ReadAllOfflineModules(module.InDir(mainDir), module.WithModCache(modCache))
+		Expect(err).To(MatchError(ContainSubstring("example.org/missing@v1.0.0")))
+	})
+
+	It("should resolve all modules of a workspace and apply its replacements", func() {
+		Expect(writeFiles(mainDir, map[string]string{
+			"go.work":  "go 1.22\n\nuse (\n\t./a\n\t./b\n)\n\nreplace example.org/c => ./c\n",
+			"a/go.mod": "module example.org/a\n\ngo 1.22\n\nrequire example.org/b v0.0.0\n",
+			"b/go.mod": "module example.org/b\n\ngo 1.22\n\nrequire example.org/c v1.0.0\n",
+			"c/go.mod": "module example.org/c\n\ngo 1.22\n",
+		})).To(Succeed())
+
+		mods, err := module.ReadAllOfflineModules(
+			module.InDir(filepath.Join(mainDir, "a")),
+			module.WithWorkFile(filepath.Join(mainDir, "go.work")),
+			module.WithModCache(modCache),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(modulePaths(mods)).To(Equal([]string{"example.org/a", "example.org/b", "example.org/c"}))
+		Expect(mods[0].Main).To(BeTrue())
+		Expect(mods[1].Main).To(BeTrue())
+		Expect(mods[2].Dir).To(Equal(filepath.Join(mainDir, "c")))
+	})
+
+	It("should error if there is no go.mod file", func() {
+		_, err := module.ReadAllOfflineModules(module.InDir(mainDir), module.WithModCache(modCache))
+		Expect(err).To(HaveOccurred())
+		Expect(os.IsNotExist(err)).To(BeFalse())
+	})
+})
+
+func modulePaths(mods []module.Module) []string {
+	paths := make([]string, 0, len(mods))
+	for _, mod := range mods {
+		paths = append(paths, mod.Path)
+	}
+	return paths
+}
@@ -0,0 +1,225 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+const (
+	// VendorDirName is the name of the vendor directory.
+	VendorDirName = "vendor"
+
+	// VendorModulesFileName is the name of the file listing the vendored modules.
+	VendorModulesFileName = "modules.txt"
+
+	// vendorGoVersion is the go version starting from which the go command uses the vendor directory by default.
+	vendorGoVersion = "1.14"
+)
+
+type OpenVendorOptions struct {
+	Dir string
+}
+
+func (o *OpenVendorOptions) ApplyToOpenVendor(o2 *OpenVendorOptions) {
+	if o.Dir != "" {
+		o2.Dir = o.Dir
+	}
+}
+
+func (o *OpenVendorOptions) ApplyOptions(opts []OpenVendorOption) {
+	for _, opt := range opts {
+		opt.ApplyToOpenVendor(o)
+	}
+}
+
+type OpenVendorOption interface {
+	ApplyToOpenVendor(o *OpenVendorOptions)
+}
+
+func (d InDir) ApplyToOpenVendor(o *OpenVendorOptions) {
+	o.Dir = string(d)
+}
+
+func setOpenVendorDefaults(o *OpenVendorOptions) {
+	if o.Dir == "" {
+		o.Dir = "."
+	}
+}
+
+// IsVendored reports whether the go command uses the vendor directory of the module containing dir
+// by default. This is the case if the module has a vendor/modules.txt file and its go version is 1.14 or higher.
+func IsVendored(dir string) (bool, error) {
+	goModFile, err := FindGoMod(dir)
+	if err != nil {
+		if errors.Is(err, errGoModNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	stat, err := os.Stat(filepath.Join(filepath.Dir(goModFile), VendorDirName, VendorModulesFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if stat.IsDir() {
+		return false, nil
+	}
+
+	file, err := parseModFile(goModFile, true)
+	if err != nil {
+		return false, fmt.Errorf("error parsing %s: %w", goModFile, err)
+	}
+	return file.Go != nil && semver.Compare("v"+file.Go.Version, "v"+vendorGoVersion) >= 0, nil
+}
+
+// OpenVendor reads the modules of the module containing dir from its vendor/modules.txt file.
+// The directory of every vendored module is vendor/<module path>.
+func OpenVendor(opts ...OpenVendorOption) (Reader, error) {
+	o := &OpenVendorOptions{}
+	o.ApplyOptions(opts)
+	setOpenVendorDefaults(o)
+
+	goModFile, err := FindGoMod(o.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	main, err := readMainModule(goModFile)
+	if err != nil {
+		return nil, err
+	}
+
+	vendorDir := filepath.Join(main.Dir, VendorDirName)
+	f, err := os.Open(filepath.Join(vendorDir, VendorModulesFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	mods, err := parseVendorModules(f, vendorDir)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", f.Name(), err)
+	}
+	return &sliceReader{mods: append([]Module{main}, mods...)}, nil
+}
+
+func ReadAllVendorModules(opts ...OpenVendorOption) ([]Module, error) {
+	r, err := OpenVendor(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return ReadAll(r)
+}
+
+func readMainModule(goModFile string) (Module, error) {
+	file, err := parseModFile(goModFile, true)
+	if err != nil {
+		return Module{}, fmt.Errorf("error parsing %s: %w", goModFile, err)
+	}
+	if file.Module == nil {
+		return Module{}, fmt.Errorf("%s does not declare a module path", goModFile)
+	}
+
+	mod := Module{
+		Path:  file.Module.Mod.Path,
+		Main:  true,
+		Dir:   filepath.Dir(goModFile),
+		GoMod: goModFile,
+	}
+	if file.Go != nil {
+		mod.GoVersion = file.Go.Version
+	}
+	return mod, nil
+}
+
+// parseVendorModules parses the module lines of a vendor/modules.txt file:
+//
+//	# <path> <version> [=> <replacement path> [<replacement version>]]
+//	## explicit[; go <go version>]
+//
+// Package lines and unknown annotations are ignored.
+func parseVendorModules(r io.Reader, vendorDir string) ([]Module, error) {
+	var (
+		mods []Module
+		cur  *Module
+	)
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "## "):
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: annotation without module", lineNo)
+			}
+			for _, annotation := range strings.Split(strings.TrimPrefix(line, "## "), ";") {
+				annotation = strings.TrimSpace(annotation)
+				switch {
+				case annotation == "explicit":
+					cur.Indirect = false
+				case strings.HasPrefix(annotation, "go "):
+					cur.GoVersion = strings.TrimPrefix(annotation, "go ")
+				}
+			}
+		case strings.HasPrefix(line, "# "):
+			mod, err := parseVendorModuleLine(strings.TrimPrefix(line, "# "), vendorDir)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			mods = append(mods, mod)
+			cur = &mods[len(mods)-1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return mods, nil
+}
+
+func parseVendorModuleLine(line, vendorDir string) (Module, error) {
+	fields := strings.Fields(line)
+
+	var replace []string
+	for i, field := range fields {
+		if field == "=>" {
+			fields, replace = fields[:i], fields[i+1:]
+			break
+		}
+	}
+
+	if len(fields) < 1 || len(fields) > 2 || (replace != nil && (len(replace) < 1 || len(replace) > 2)) {
+		return Module{}, fmt.Errorf("invalid module line %q", line)
+	}
+
+	mod := Module{
+		Path: fields[0],
+		// Modules are indirect unless annotated as explicit.
+		Indirect: true,
+		Dir:      filepath.Join(vendorDir, filepath.FromSlash(fields[0])),
+	}
+	if len(fields) == 2 {
+		mod.Version = fields[1]
+	}
+	if replace != nil {
+		mod.Replace = &Module{Path: replace[0]}
+		if len(replace) == 2 {
+			mod.Replace.Version = replace[1]
+		}
+	}
+	if !dirExists(mod.Dir) {
+		mod.Dir = ""
+	}
+	return mod, nil
+}
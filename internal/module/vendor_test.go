@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module_test
+
+import (
+	"path/filepath"
+
+	"github.com/ironcore-dev/vgopath/internal/module"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Vendor", func() {
+	var mainDir string
+	BeforeEach(func() {
+		mainDir = GinkgoT().TempDir()
+		Expect(writeFiles(mainDir, map[string]string{
+			"go.mod": "module example.org/main\n\ngo 1.22\n",
+		})).To(Succeed())
+	})
+
+	Describe("IsVendored", func() {
+		It("should report false if there is no vendor/modules.txt", func() {
+			Expect(module.IsVendored(mainDir)).To(BeFalse())
+		})
+
+		It("should report true if there is a vendor/modules.txt", func() {
+			Expect(writeFiles(mainDir, map[string]string{"vendor/modules.txt": ""})).To(Succeed())
+			Expect(module.IsVendored(filepath.Join(mainDir, "vendor"))).To(BeTrue())
+		})
+
+		It("should report false if the go version is lower than 1.14", func() {
+			Expect(writeFiles(mainDir, map[string]string{
+				"go.mod":             "module example.org/main\n\ngo 1.13\n",
+				"vendor/modules.txt": "",
+			})).To(Succeed())
+			Expect(module.IsVendored(mainDir)).To(BeFalse())
+		})
+
+		It("should report false if there is no go.mod", func() {
+			Expect(module.IsVendored(GinkgoT().TempDir())).To(BeFalse())
+		})
+	})
+
+	Describe("OpenVendor", func() {
+		It("should map every vendored module to its vendor directory", func() {
+			Expect(writeFiles(mainDir, map[string]string{
+				"vendor/modules.txt": `# example.org/a v1.0.0
+## explicit; go 1.20
+example.org/a
+example.org/a/sub
+# example.org/b v1.2.0 => example.org/b-fork v1.2.1
+## go 1.21
+example.org/b
+# example.org/c v0.1.0
+## explicit
+# example.org/d => ../d
+## explicit; go 1.22
+example.org/d
+`,
+				"vendor/example.org/a/a.go":     "package a\n",
+				"vendor/example.org/a/sub/s.go": "package sub\n",
+				"vendor/example.org/b/b.go":     "package b\n",
+				"vendor/example.org/d/d.go":     "package d\n",
+			})).To(Succeed())
+
+			mods, err := module.ReadAllVendorModules(module.InDir(mainDir))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mods).To(Equal([]module.Module{
+				{
+					Path:      "example.org/main",
+					Main:      true,
+					Dir:       mainDir,
+					GoMod:     filepath.Join(mainDir, "go.mod"),
+					GoVersion: "1.22",
+				},
+				{
+					Path:      "example.org/a",
+					Version:   "v1.0.0",
+					Dir:       filepath.Join(mainDir, "vendor", "example.org", "a"),
+					GoVersion: "1.20",
+				},
+				{
+					Path:      "example.org/b",
+					Version:   "v1.2.0",
+					Replace:   &module.Module{Path: "example.org/b-fork", Version: "v1.2.1"},
+					Indirect:  true,
+					Dir:       filepath.Join(mainDir, "vendor", "example.org", "b"),
+					GoVersion: "1.21",
+				},
+				{
+					Path:    "example.org/c",
+					Version: "v0.1.0",
+				},
+				{
+					Path:      "example.org/d",
+					Replace:   &module.Module{Path: "../d"},
+					Dir:       filepath.Join(mainDir, "vendor", "example.org", "d"),
+					GoVersion: "1.22",
+				},
+			}))
+		})
+
+		It("should error on malformed module lines", func() {
+			Expect(writeFiles(mainDir, map[string]string{
+				"vendor/modules.txt": "# example.org/a v1.0.0 =>\n",
+			})).To(Succeed())
+
+			_, err := module.ReadAllVendorModules(module.InDir(mainDir))
+			Expect(err).To(MatchError(ContainSubstring("line 1")))
+		})
+	})
+})
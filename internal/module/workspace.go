@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// GoWorkFileName is the name of the go workspace file.
+	GoWorkFileName = "go.work"
+
+	// GoWorkOff is the GOWORK value that disables workspace mode.
+	GoWorkOff = "off"
+)
+
+// FindGoWork determines the go.work file that applies to dir, the same way the go command does:
+// If GOWORK is set, its value is used ("off" disables workspace mode), otherwise dir and its
+// parents are searched for a go.work file. An empty string is returned if no workspace applies.
+func FindGoWork(dir string) (string, error) {
+	if gowork, ok := os.LookupEnv("GOWORK"); ok && gowork != "" {
+		if gowork == GoWorkOff {
+			return "", nil
+		}
+		return filepath.Abs(gowork)
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		filename := filepath.Join(dir, GoWorkFileName)
+		stat, err := os.Stat(filename)
+		if err == nil && !stat.IsDir() {
+			return filename, nil
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("error checking for %s: %w", filename, err)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
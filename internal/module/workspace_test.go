@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package module_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/ironcore-dev/vgopath/internal/module"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Workspace", func() {
+	var workspaceDir string
+	BeforeEach(func() {
+		workspaceDir = GinkgoT().TempDir()
+		Expect(writeFiles(workspaceDir, map[string]string{
+			"go.work":  "go 1.22\n\nuse (\n\t./a\n\t./b\n)\n",
+			"a/go.mod": "module example.org/a\n\ngo 1.22\n",
+			"b/go.mod": "module example.org/b\n\ngo 1.22\n",
+		})).To(Succeed())
+	})
+
+	Describe("FindGoWork", func() {
+		It("should find the go.work file in a parent directory", func() {
+			GinkgoT().Setenv("GOWORK", "")
+
+			workFile, err := module.FindGoWork(filepath.Join(workspaceDir, "a"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workFile).To(Equal(filepath.Join(workspaceDir, "go.work")))
+		})
+
+		It("should return an empty string if GOWORK is off", func() {
+			GinkgoT().Setenv("GOWORK", "off")
+
+			workFile, err := module.FindGoWork(filepath.Join(workspaceDir, "a"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workFile).To(BeEmpty())
+		})
+
+		It("should use the go.work file set via GOWORK", func() {
+			GinkgoT().Setenv("GOWORK", filepath.Join(workspaceDir, "other.work"))
+
+			workFile, err := module.FindGoWork(GinkgoT().TempDir())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workFile).To(Equal(filepath.Join(workspaceDir, "other.work")))
+		})
+	})
+
+	Describe("OpenGoList", func() {
+		goList := func() *exec.Cmd {
+			cmd := exec.Command("go", "list", "-m", "-json", "all")
+			// -mod=mod is not allowed in workspace mode.
+			cmd.Env = append(os.Environ(), "GOFLAGS=")
+			return cmd
+		}
+
+		It("should list every main module of the workspace", func() {
+			mods, err := module.ReadAllGoListModules(
+				module.InDir(filepath.Join(workspaceDir, "a")),
+				module.WithWorkFile(filepath.Join(workspaceDir, "go.work")),
+				&module.OpenGoListOptions{Command: goList},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mods).To(ConsistOf(
+				workspaceModule(workspaceDir, "a"),
+				workspaceModule(workspaceDir, "b"),
+			))
+		})
+
+		It("should only list the current module if the workspace is off", func() {
+			mods, err := module.ReadAllGoListModules(
+				module.InDir(filepath.Join(workspaceDir, "a")),
+				module.WithWorkFile(module.GoWorkOff),
+				&module.OpenGoListOptions{Command: goList},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mods).To(ConsistOf(
+				workspaceModule(workspaceDir, "a"),
+			))
+		})
+	})
+})
+
+func workspaceModule(workspaceDir, name string) module.Module {
+	return module.Module{
+		Path:      "example.org/" + name,
+		Main:      true,
+		Dir:       filepath.Join(workspaceDir, name),
+		GoMod:     filepath.Join(workspaceDir, name, "go.mod"),
+		GoVersion: "1.22",
+	}
+}
+
+func writeFiles(dir string, files map[string]string) error {
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filename, []byte(content), 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
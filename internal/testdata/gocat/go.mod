@@ -1 +0,0 @@
-module gocat
\ No newline at end of file
@@ -3,7 +3,11 @@
 
 package testdata
 
-import "github.com/ironcore-dev/vgopath/internal/module"
+import (
+	"time"
+
+	"github.com/ironcore-dev/vgopath/internal/module"
+)
 
 var (
 	ModuleA = module.Module{
@@ -27,3 +31,45 @@ var (
 		ModuleD,
 	}
 )
+
+var (
+	bForkTime = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	FullModuleA = module.Module{
+		Path:      "a",
+		Main:      true,
+		Dir:       "/tmp/a",
+		GoMod:     "/tmp/a/go.mod",
+		GoVersion: "1.22",
+	}
+
+	FullModuleB = module.Module{
+		Path:    "example.org/b",
+		Version: "v1.2.3",
+		Replace: &module.Module{
+			Path:      "example.org/b-fork",
+			Version:   "v1.2.4",
+			Time:      &bForkTime,
+			Dir:       "/tmp/example.org/b-fork@v1.2.4",
+			GoMod:     "/tmp/cache/download/example.org/b-fork/@v/v1.2.4.mod",
+			GoVersion: "1.20",
+		},
+		Indirect:   true,
+		Dir:        "/tmp/example.org/b-fork@v1.2.4",
+		GoMod:      "/tmp/cache/download/example.org/b-fork/@v/v1.2.4.mod",
+		GoVersion:  "1.20",
+		Deprecated: "use example.org/c instead",
+	}
+
+	FullModuleD = module.Module{
+		Path:    "example.org/d",
+		Version: "v0.1.0",
+		Error:   &module.Error{Err: "module example.org/d: not found"},
+	}
+
+	FullModules = []module.Module{
+		FullModuleA,
+		FullModuleB,
+		FullModuleD,
+	}
+)